@@ -1,9 +1,14 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	utils "hnterminal/internal/utils"
+	"io/fs"
 	"os"
+	"time"
 
 	arg "github.com/alexflint/go-arg"
 )
@@ -11,18 +16,94 @@ import (
 const DEFAULT_STORY_COUNT = 10
 const DEFAULT_COMMAND = ""
 const DEFAULT_DB_PATH = ""
-
-var ValidCommands = [...]string{"top", "comment"}
+const DEFAULT_FEED = "top"
+const DEFAULT_COMMENT_DEPTH = 0
+const DEFAULT_BASE_URL = "https://hacker-news.firebaseio.com/v0/"
+const DEFAULT_CONCURRENCY = 4
+const DEFAULT_MAX_AGE = time.Hour * 24 * 30
+const DEFAULT_SEARCH_URL = "https://hn.algolia.com/api/v1/"
+const DEFAULT_PAGE = 1
+const DEFAULT_OUTPUT = "text"
+const DEFAULT_FEED_FORMAT = "rss"
+const DEFAULT_ADDR = "127.0.0.1:8080"
+
+var ValidCommands = [...]string{"top", "comments", "user", "sync", "cache", "save", "unsave", "saved", "search", "item", "feed", "serve"}
 
 var cliArgs struct {
-	StoryCount int    `arg:"-c,--count" help:"Number of strories to show"`
-	Command    string `arg:"positional" help:"Command to execute (top)"`
+	StoryCount  int           `arg:"-c,--count" help:"Number of strories or search results to show"`
+	Feed        string        `arg:"-f,--feed" help:"Story feed to show (top, new, best, ask, show, job), feed export also takes saved"`
+	Depth       int           `arg:"-d,--depth" help:"Maximum depth of the comment tree (0 = unlimited)"`
+	HideDead    bool          `arg:"--hide-dead" help:"Hide dead and deleted comments instead of collapsing them"`
+	BaseUrl     string        `arg:"--base-url,env:HN_BASE_URL" help:"Base url of the Hacker News API"`
+	Offline     bool          `arg:"--offline,env:HN_OFFLINE" help:"Show only the cached stories, comments and users without using the network"`
+	Concurrency int           `arg:"--concurrency" help:"Number of stories downloaded at once by sync"`
+	MaxAge      time.Duration `arg:"--max-age" help:"Items fetched longer ago are removed by cache gc"`
+	Unlinked    bool          `arg:"--unlinked" help:"Make cache gc remove every item not linked to a saved item"`
+	Tags        []string      `arg:"-t,--tag,separate" help:"Tag of the item for save, tag to filter by for saved"`
+	Note        string        `arg:"--note" help:"Personal note of the item for save"`
+	Remote      bool          `arg:"--remote" help:"Make search use the Hacker News search API instead of the cache"`
+	Page        int           `arg:"--page" help:"Page of the results of a remote search"`
+	SearchUrl   string        `arg:"--search-url,env:HN_SEARCH_URL" help:"Base url of the Hacker News search API"`
+	Output      string        `arg:"-o,--output" help:"Output format of top, item, comments, user, search and saved (text, json, ndjson, csv, markdown, template)"`
+	Template    string        `arg:"--template" help:"Go text/template executed for every item or user with the template output, e.g. '{{.Id}} {{.Title}}'"`
+	FeedFormat  string        `arg:"--format" help:"Format of feed export (rss, atom)"`
+	MinScore    int           `arg:"--min-score" help:"Minimum score of the stories exported by feed export"`
+	Domains     []string      `arg:"--domain,separate" help:"Domain of the stories exported by feed export"`
+	Keywords    []string      `arg:"--keyword,separate" help:"Keyword of the stories exported by feed export"`
+	Addr        string        `arg:"--addr,env:HN_ADDR" help:"Address the serve command listens on"`
+	NoFilter    bool          `arg:"--no-filter" help:"Show the stories and comments hidden or down-ranked by the rules of the config file"`
+	Command     string        `arg:"positional" help:"Command to execute (top, comments, user, sync, cache, save, unsave, saved, search, item, feed, serve)"`
+	Args        []string      `arg:"positional" help:"Arguments of the command"`
 }
 
 type Config struct {
-	StoryCount int
-	Command    string
-	DbPath     string
+	StoryCount  int
+	Command     string
+	DbPath      string
+	Feed        string
+	Args        []string
+	Depth       int
+	HideDead    bool
+	BaseUrl     string
+	Offline     bool
+	Concurrency int
+	MaxAge      time.Duration
+	Unlinked    bool
+	Tags        []string
+	Note        string
+	Remote      bool
+	Page        int
+	SearchUrl   string
+	Output      string
+	Template    string
+	FeedFormat  string
+	MinScore    int
+	Domains     []string
+	Keywords    []string
+	Addr        string
+	NoFilter    bool
+	Rules       []RuleConfig
+}
+
+/*
+RuleConfig is a rule of the config file hiding or down-ranking the stories and comments
+matching all of its conditions, see the rules package
+*/
+type RuleConfig struct {
+	Name        string   `json:"name"`
+	Action      string   `json:"action"` // hide (default) or downrank
+	Items       string   `json:"items"`  // stories, comments or all (default)
+	Domains     []string `json:"domains"`
+	Authors     []string `json:"authors"`
+	Title       string   `json:"title"` // regular expression, matched against the titles of the stories
+	Text        string   `json:"text"`  // regular expression, matched against the text of the comments and posts
+	MinScore    int      `json:"min_score"`
+	MinComments int      `json:"min_comments"`
+}
+
+// the content of the config file
+type fileConfig struct {
+	Rules []RuleConfig `json:"rules"`
 }
 
 var isConfigInitialized = false
@@ -32,9 +113,19 @@ var currentConfig = Config{}
 func New() *Config {
 	// set default config values
 	currentConfig = Config{
-		DEFAULT_STORY_COUNT,
-		DEFAULT_COMMAND,
-		getDefaultDbPath(),
+		StoryCount:  DEFAULT_STORY_COUNT,
+		Command:     DEFAULT_COMMAND,
+		DbPath:      getDefaultDbPath(),
+		Feed:        DEFAULT_FEED,
+		Depth:       DEFAULT_COMMENT_DEPTH,
+		BaseUrl:     DEFAULT_BASE_URL,
+		Concurrency: DEFAULT_CONCURRENCY,
+		MaxAge:      DEFAULT_MAX_AGE,
+		Page:        DEFAULT_PAGE,
+		SearchUrl:   DEFAULT_SEARCH_URL,
+		Output:      DEFAULT_OUTPUT,
+		FeedFormat:  DEFAULT_FEED_FORMAT,
+		Addr:        DEFAULT_ADDR,
 	}
 	parseConfig()
 	parseArgs()
@@ -46,6 +137,18 @@ func New() *Config {
 Parses and validates command line args
 */
 func parseArgs() {
+	// the current config values are used as defaults for the args
+	cliArgs.StoryCount = currentConfig.StoryCount
+	cliArgs.Feed = currentConfig.Feed
+	cliArgs.Depth = currentConfig.Depth
+	cliArgs.BaseUrl = currentConfig.BaseUrl
+	cliArgs.Concurrency = currentConfig.Concurrency
+	cliArgs.MaxAge = currentConfig.MaxAge
+	cliArgs.Page = currentConfig.Page
+	cliArgs.SearchUrl = currentConfig.SearchUrl
+	cliArgs.Output = currentConfig.Output
+	cliArgs.FeedFormat = currentConfig.FeedFormat
+	cliArgs.Addr = currentConfig.Addr
 	arg.MustParse(&cliArgs)
 	isValidCommand := false
 	if cliArgs.Command != "" {
@@ -64,11 +167,64 @@ func parseArgs() {
 	}
 
 	currentConfig.Command = cliArgs.Command
+	currentConfig.Args = cliArgs.Args
+	currentConfig.Depth = cliArgs.Depth
+	currentConfig.HideDead = cliArgs.HideDead
+	currentConfig.BaseUrl = cliArgs.BaseUrl
+	currentConfig.Offline = cliArgs.Offline
+	currentConfig.Concurrency = cliArgs.Concurrency
+	currentConfig.MaxAge = cliArgs.MaxAge
+	currentConfig.Unlinked = cliArgs.Unlinked
+	currentConfig.Tags = cliArgs.Tags
+	currentConfig.Note = cliArgs.Note
+	currentConfig.Remote = cliArgs.Remote
+	currentConfig.Page = cliArgs.Page
+	currentConfig.SearchUrl = cliArgs.SearchUrl
+	currentConfig.Output = cliArgs.Output
+	currentConfig.Template = cliArgs.Template
+	currentConfig.FeedFormat = cliArgs.FeedFormat
+	currentConfig.MinScore = cliArgs.MinScore
+	currentConfig.Domains = cliArgs.Domains
+	currentConfig.Keywords = cliArgs.Keywords
+	currentConfig.Addr = cliArgs.Addr
+	currentConfig.NoFilter = cliArgs.NoFilter
 	currentConfig.StoryCount = cliArgs.StoryCount
+	currentConfig.Feed = cliArgs.Feed
 }
 
+/*
+Reads the config file if it exists, a missing file keeps the defaults
+*/
 func parseConfig() {
 	currentConfig.DbPath = getDefaultDbPath()
+	path := GetConfigPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		utils.HandleError(fmt.Errorf("the config file could not be read: %w\n", err), utils.ErrorSeverityFatal)
+	}
+	var file fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		utils.HandleError(fmt.Errorf("invalid config file %s: %w\n", path, err), utils.ErrorSeverityFatal)
+	}
+	currentConfig.Rules = file.Rules
+}
+
+// GetConfigPath returns the path of the config file, HN_CONFIG overrides the default one
+func GetConfigPath() string {
+	if path := os.Getenv("HN_CONFIG"); path != "" {
+		return path
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = fmt.Sprintf("%s/.config", os.Getenv("HOME"))
+	}
+
+	return fmt.Sprintf("%s/hacker-news-terminal/config.json", configHome)
 }
 
 func IsTUI() bool {
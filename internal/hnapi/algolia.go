@@ -0,0 +1,243 @@
+package hnapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const ALGOLIA_BASE_URL = "https://hn.algolia.com/api/v1/"
+const DEFAULT_HITS_PER_PAGE = 20
+
+/*
+The tags of the Algolia search, the tags of a request must all match. The authors and the
+stories are matched with AuthorTag and StoryTag.
+*/
+const (
+	TAG_STORY      = "story"
+	TAG_COMMENT    = "comment"
+	TAG_POLL       = "poll"
+	TAG_POLLOPT    = "pollopt"
+	TAG_JOB        = "job"
+	TAG_ASK_HN     = "ask_hn"
+	TAG_SHOW_HN    = "show_hn"
+	TAG_FRONT_PAGE = "front_page"
+)
+
+// AuthorTag returns the tag of the items submitted by the user
+func AuthorTag(user string) string {
+	return "author_" + user
+}
+
+// StoryTag returns the tag of the story and of its comments
+func StoryTag(id int) string {
+	return fmt.Sprintf("story_%d", id)
+}
+
+/*
+SearchRequest is a query of the Algolia search. NumericFilters are conditions on the
+points, num_comments and created_at_i (unix time) of the hits like "points>100".
+Page starts at 0, the hits are sorted by date instead of relevance if ByDate is set.
+*/
+type SearchRequest struct {
+	Query          string
+	Tags           []string
+	NumericFilters []string
+	Page           int
+	HitsPerPage    int
+	ByDate         bool
+}
+
+/*
+SearchHit is an item matching a search, the fields that don't apply to its type are empty
+*/
+type SearchHit struct {
+	ObjectId    string   `json:"objectID"`
+	CreatedAt   int64    `json:"created_at_i"` // unix time
+	Title       string   `json:"title"`
+	Url         string   `json:"url"`
+	Author      string   `json:"author"`
+	Points      int      `json:"points"`
+	StoryText   string   `json:"story_text"`
+	CommentText string   `json:"comment_text"`
+	NumComments int      `json:"num_comments"`
+	StoryId     int      `json:"story_id"`
+	StoryTitle  string   `json:"story_title"`
+	ParentId    int      `json:"parent_id"`
+	Tags        []string `json:"_tags"`
+}
+
+// Id returns the id of the item of the hit, 0 if it is invalid
+func (h *SearchHit) Id() int {
+	id, _ := strconv.Atoi(h.ObjectId)
+	return id
+}
+
+// Type returns the type of the item of the hit (story, comment, ...) based on its tags
+func (h *SearchHit) Type() string {
+	for _, itemType := range []string{TAG_STORY, TAG_COMMENT, TAG_POLL, TAG_POLLOPT, TAG_JOB} {
+		if slices.Contains(h.Tags, itemType) {
+			return itemType
+		}
+	}
+	return ""
+}
+
+// Item converts the hit to an item, the kids of the item are not known
+func (h *SearchHit) Item() *Item {
+	item := &Item{
+		Id:            h.Id(),
+		By:            h.Author,
+		Time:          int(h.CreatedAt),
+		Type:          h.Type(),
+		Title:         h.Title,
+		Url:           h.Url,
+		Score:         h.Points,
+		CommentsCount: h.NumComments,
+		Parent:        h.ParentId,
+		Text:          h.StoryText,
+	}
+	if h.CommentText != "" {
+		item.Text = h.CommentText
+	}
+	return item
+}
+
+/*
+SearchResponse is a page of the hits of a search
+*/
+type SearchResponse struct {
+	Hits        []*SearchHit `json:"hits"`
+	Page        int          `json:"page"`
+	Pages       int          `json:"nbPages"`
+	HitsCount   int          `json:"nbHits"`
+	HitsPerPage int          `json:"hitsPerPage"`
+}
+
+// HasNextPage returns true if there are more hits after this page
+func (r *SearchResponse) HasNextPage() bool {
+	return r.Page+1 < r.Pages
+}
+
+/*
+SearchItem is an item of the Algolia API with its whole tree of comments
+*/
+type SearchItem struct {
+	Id        int           `json:"id"`
+	CreatedAt int64         `json:"created_at_i"` // unix time
+	Type      string        `json:"type"`
+	Author    string        `json:"author"`
+	Title     string        `json:"title"`
+	Url       string        `json:"url"`
+	Text      string        `json:"text"`
+	Points    int           `json:"points"`
+	ParentId  int           `json:"parent_id"`
+	StoryId   int           `json:"story_id"`
+	Children  []*SearchItem `json:"children"`
+}
+
+// Item converts the search item to an item, the children become the kids
+func (s *SearchItem) Item() *Item {
+	item := &Item{
+		Id:     s.Id,
+		By:     s.Author,
+		Time:   int(s.CreatedAt),
+		Type:   s.Type,
+		Title:  s.Title,
+		Url:    s.Url,
+		Text:   s.Text,
+		Score:  s.Points,
+		Parent: s.ParentId,
+	}
+	for _, child := range s.Children {
+		item.Kids = append(item.Kids, child.Id)
+	}
+	return item
+}
+
+/*
+SearchClient searches the stories and comments of Hacker News with the Algolia HN search API
+*/
+type SearchClient struct {
+	api *ApiClient
+}
+
+/*
+NewSearchClient returns a client for the search API under baseUrl, the requests are
+retried like the ones of ApiClient. The default http client and ALGOLIA_BASE_URL are
+used for nil and empty values.
+*/
+func NewSearchClient(httpClient *http.Client, baseUrl string) *SearchClient {
+	if baseUrl == "" {
+		baseUrl = ALGOLIA_BASE_URL
+	}
+	return &SearchClient{NewApiClient(httpClient, baseUrl)}
+}
+
+func (s *SearchClient) BaseUrl() string {
+	return s.api.BaseUrl()
+}
+
+func (s *SearchClient) SetRetryPolicy(policy RetryPolicy) {
+	s.api.SetRetryPolicy(policy)
+}
+
+/*
+Search returns a page of the items matching the request
+*/
+func (s *SearchClient) Search(ctx context.Context, request SearchRequest) (*SearchResponse, error) {
+	path := "search"
+	if request.ByDate {
+		path = "search_by_date"
+	}
+	params := url.Values{}
+	params.Set("query", request.Query)
+	if len(request.Tags) > 0 {
+		params.Set("tags", strings.Join(request.Tags, ","))
+	}
+	if len(request.NumericFilters) > 0 {
+		params.Set("numericFilters", strings.Join(request.NumericFilters, ","))
+	}
+	params.Set("page", strconv.Itoa(request.Page))
+	hitsPerPage := request.HitsPerPage
+	if hitsPerPage <= 0 {
+		hitsPerPage = DEFAULT_HITS_PER_PAGE
+	}
+	params.Set("hitsPerPage", strconv.Itoa(hitsPerPage))
+
+	body, err := s.api.get(ctx, path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error while searching the hacker-news stories: %w", err)
+	}
+	var response SearchResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error while decoding the search response: %w", err)
+	}
+	return &response, nil
+}
+
+/*
+GetItem returns the item by id with its tree of comments from the search API,
+ErrNotFound if there is no such item
+*/
+func (s *SearchClient) GetItem(ctx context.Context, id int) (*SearchItem, error) {
+	body, err := s.api.get(ctx, fmt.Sprintf("items/%d", id))
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("item %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the item from the search API: %w", err)
+	}
+	var item SearchItem
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, fmt.Errorf("error while decoding the item %d: %w", id, err)
+	}
+	return &item, nil
+}
@@ -0,0 +1,104 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"testing"
+)
+
+func hitIds(response *hnapi.SearchResponse) []int {
+	ids := make([]int, len(response.Hits))
+	for i, hit := range response.Hits {
+		ids[i] = hit.Id()
+	}
+	return ids
+}
+
+func Test_SearchClient_Search(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	client := hnapi.NewSearchClient(nil, server.SearchUrl())
+	ctx := context.Background()
+
+	response, err := client.Search(ctx, hnapi.SearchRequest{Query: "hacker news"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := hitIds(response); len(ids) != 2 || ids[0] != 100 || ids[1] != 300 {
+		t.Errorf("Expected the 2 matching stories by points, got %v", ids)
+	}
+	hit := response.Hits[0]
+	if hit.Type() != "story" || hit.Author != "alice" || hit.Points != 120 || hit.Title != "Show HN: A terminal reader for Hacker News" {
+		t.Errorf("Expected the typed fields of the story, got %+v", hit)
+	}
+
+	response, _ = client.Search(ctx, hnapi.SearchRequest{Tags: []string{hnapi.TAG_COMMENT, hnapi.AuthorTag("bob")}})
+	if ids := hitIds(response); len(ids) != 1 || ids[0] != 101 {
+		t.Errorf("Expected the comment of bob, got %v", ids)
+	}
+	if item := response.Hits[0].Item(); item.Type != "comment" || item.Parent != 100 || item.Text == "" {
+		t.Errorf("Expected the hit to convert to the comment, got %+v", item)
+	}
+	if response.Hits[0].StoryId != 100 {
+		t.Errorf("Expected the story of the comment, got %d", response.Hits[0].StoryId)
+	}
+
+	response, _ = client.Search(ctx, hnapi.SearchRequest{Tags: []string{hnapi.TAG_ASK_HN}})
+	if ids := hitIds(response); len(ids) != 1 || ids[0] != 300 {
+		t.Errorf("Expected the ask HN story, got %v", ids)
+	}
+	response, _ = client.Search(ctx, hnapi.SearchRequest{Tags: []string{hnapi.TAG_STORY}, NumericFilters: []string{"points>100"}})
+	if ids := hitIds(response); len(ids) != 2 {
+		t.Errorf("Expected the 2 stories with more than 100 points, got %v", ids)
+	}
+}
+
+func Test_SearchClient_Paging(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	client := hnapi.NewSearchClient(nil, server.SearchUrl())
+	ctx := context.Background()
+
+	request := hnapi.SearchRequest{Tags: []string{hnapi.TAG_STORY}, ByDate: true, HitsPerPage: 2}
+	first, err := client.Search(ctx, request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := hitIds(first); len(ids) != 2 || ids[0] != 300 || ids[1] != 200 {
+		t.Errorf("Expected the 2 newest stories, got %v", ids)
+	}
+	if first.HitsCount != 3 || first.Pages != 2 || !first.HasNextPage() {
+		t.Errorf("Expected 3 hits on 2 pages, got %d on %d", first.HitsCount, first.Pages)
+	}
+	request.Page = 1
+	second, _ := client.Search(ctx, request)
+	if ids := hitIds(second); len(ids) != 1 || ids[0] != 100 || second.HasNextPage() {
+		t.Errorf("Expected the oldest story on the last page, got %v", ids)
+	}
+	if server.RequestCount("search_by_date") != 2 {
+		t.Errorf("Expected the requests to use search_by_date, got %d", server.RequestCount("search_by_date"))
+	}
+}
+
+func Test_SearchClient_GetItem(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	client := hnapi.NewSearchClient(nil, server.SearchUrl())
+	client.SetRetryPolicy(hnapi.NoRetryPolicy)
+
+	item, err := client.GetItem(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(item.Children) != 2 || len(item.Children[0].Children) != 2 || item.Children[0].Children[0].Author != "alice" {
+		t.Errorf("Expected the tree of comments, got %+v", item)
+	}
+	if converted := item.Item(); len(converted.Kids) != 2 || converted.Title != item.Title {
+		t.Errorf("Expected the children to become the kids, got %+v", converted)
+	}
+	if _, err := client.GetItem(context.Background(), 12345); !errors.Is(err, hnapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
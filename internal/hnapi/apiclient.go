@@ -1,10 +1,13 @@
 package hnapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -14,35 +17,129 @@ const (
 )
 
 type ApiClient struct {
-	client *http.Client
+	client      *http.Client
+	baseUrl     string
+	retryPolicy RetryPolicy
+	breaker     *CircuitBreaker
 }
 
-func NewApiClient(httpClient *http.Client) *ApiClient {
+/*
+NewApiClient returns a client for the API under baseUrl,
+the default http client and HN_BASE_URL are used for nil and empty values
+*/
+func NewApiClient(httpClient *http.Client, baseUrl string) *ApiClient {
 	if httpClient == nil {
 		httpClient = CreateHttpClient(DEFAULT_TIMEOUT)
 	}
-	return &ApiClient{httpClient}
+	if baseUrl == "" {
+		baseUrl = HN_BASE_URL
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+	return &ApiClient{httpClient, baseUrl, DefaultRetryPolicy, NewCircuitBreaker(DEFAULT_BREAKER_THRESHOLD, DEFAULT_BREAKER_COOLDOWN)}
+}
+
+func (api *ApiClient) BaseUrl() string {
+	return api.baseUrl
+}
+
+func (api *ApiClient) SetRetryPolicy(policy RetryPolicy) {
+	api.retryPolicy = policy
+}
+
+// SetCircuitBreaker replaces the circuit breaker of the client, nil disables it
+func (api *ApiClient) SetCircuitBreaker(breaker *CircuitBreaker) {
+	api.breaker = breaker
 }
 
 /*
-GetTopStoryIds returns the newest item ids from the Hacker News API
+get returns the body of the response for the path relative to the API base url.
+Network errors, 429 and 5xx responses are retried according to the retry policy,
+everything is aborted when ctx is done.
 */
-func (api *ApiClient) GetTopStoryIds() ([]int, error) {
-	response, err := api.client.Get(fmt.Sprintf("%s/topstories.json", HN_BASE_URL))
+func (api *ApiClient) get(ctx context.Context, path string) ([]byte, error) {
+	requestUrl := api.baseUrl + path
+	if api.breaker != nil {
+		if err := api.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+	var lastError error
+	attempt := 0
+	for attempt < max(api.retryPolicy.MaxAttempts, 1) {
+		attempt++
+		body, response, err := api.getOnce(ctx, requestUrl)
+		if err == nil {
+			if api.breaker != nil {
+				api.breaker.Success()
+			}
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastError = err
+		if !IsTemporary(err) || attempt >= api.retryPolicy.MaxAttempts {
+			break
+		}
+		delay := max(api.retryPolicy.Delay(attempt), min(retryAfter(response), api.retryPolicy.MaxDelay))
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	if api.breaker != nil {
+		if IsTemporary(lastError) {
+			api.breaker.Failure()
+		} else { // the API is up, the request was wrong
+			api.breaker.Success()
+		}
+	}
+	return nil, &RequestError{requestUrl, attempt, lastError}
+}
+
+func (api *ApiClient) getOnce(ctx context.Context, url string) ([]byte, *http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err := api.client.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("error while getting the newest items: %w", err)
+		return nil, nil, err
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code while getting the newest items: %d", response.StatusCode)
+		return nil, response, &StatusError{url, response.StatusCode}
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, response, err
+	}
+	return body, response, nil
+}
+
+/*
+GetTopStoryIds returns the top story ids from the Hacker News API
+*/
+func (api *ApiClient) GetTopStoryIds(ctx context.Context) ([]int, error) {
+	return api.GetFeedIds(ctx, FeedTop)
+}
+
+/*
+GetFeedIds returns the story ids of the given feed from the Hacker News API
+*/
+func (api *ApiClient) GetFeedIds(ctx context.Context, feed Feed) ([]int, error) {
+	response, err := api.get(ctx, feed.Path())
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the %s stories: %w", feed, err)
 	}
 
 	var stories []int
-	err = json.NewDecoder(response.Body).Decode(&stories)
+	err = json.Unmarshal(response, &stories)
 	if err != nil {
-		return nil, fmt.Errorf("error while decoding the top stories response: %w", err)
+		return nil, fmt.Errorf("error while decoding the %s stories response: %w", feed, err)
 	}
 
 	return stories, nil
@@ -51,16 +148,59 @@ func (api *ApiClient) GetTopStoryIds() ([]int, error) {
 /*
 GetItem returns the item by id as raw bytes from the Hacker News API
 */
-func (api *ApiClient) GetItem(itemId int) ([]byte, error) {
-	response, err := api.client.Get(fmt.Sprintf("%s/item/%d.json", HN_BASE_URL, itemId))
+func (api *ApiClient) GetItem(ctx context.Context, itemId int) ([]byte, error) {
+	item, err := api.get(ctx, fmt.Sprintf("item/%d.json", itemId))
 	if err != nil {
 		return nil, fmt.Errorf("error while getting the item from the hacker-news API: %w", err)
 	}
-	item, err := io.ReadAll(response.Body)
+	return item, nil
+}
+
+/*
+GetUser returns the user profile by id as raw bytes from the Hacker News API
+*/
+func (api *ApiClient) GetUser(ctx context.Context, userId string) ([]byte, error) {
+	user, err := api.get(ctx, fmt.Sprintf("user/%s.json", url.PathEscape(userId)))
 	if err != nil {
-		return nil, fmt.Errorf("error while reading the item response: %w", err)
+		return nil, fmt.Errorf("error while getting the user from the hacker-news API: %w", err)
 	}
-	return item, nil
+	return user, nil
+}
+
+/*
+GetUpdates returns the ids of the recently changed items and user profiles from the Hacker News API
+*/
+func (api *ApiClient) GetUpdates(ctx context.Context) (*Updates, error) {
+	response, err := api.get(ctx, "updates.json")
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the updates: %w", err)
+	}
+
+	var updates Updates
+	err = json.Unmarshal(response, &updates)
+	if err != nil {
+		return nil, fmt.Errorf("error while decoding the updates response: %w", err)
+	}
+
+	return &updates, nil
+}
+
+/*
+GetMaxItem returns the id of the newest item from the Hacker News API
+*/
+func (api *ApiClient) GetMaxItem(ctx context.Context) (int, error) {
+	response, err := api.get(ctx, "maxitem.json")
+	if err != nil {
+		return 0, fmt.Errorf("error while getting the max item: %w", err)
+	}
+
+	var maxItem int
+	err = json.Unmarshal(response, &maxItem)
+	if err != nil {
+		return 0, fmt.Errorf("error while decoding the max item response: %w", err)
+	}
+
+	return maxItem, nil
 }
 
 func CreateHttpClient(timeout time.Duration) *http.Client {
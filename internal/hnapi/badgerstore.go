@@ -0,0 +1,196 @@
+package hnapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// the ratio of discardable data of a value log file to rewrite it on Compact
+const BADGER_GC_DISCARD_RATIO = 0.5
+
+/*
+BadgerStore keeps the records in a badger database on the disk
+*/
+type BadgerStore struct {
+	records
+	db       *badger.DB
+	readOnly bool
+}
+
+/*
+OpenBadgerStore opens or creates the database in the directory and migrates it to the current
+schema. A database locked by another process is opened read-only if possible, otherwise or if
+its schema is outdated the returned error wraps ErrStoreLocked.
+*/
+func OpenBadgerStore(path string) (*BadgerStore, error) {
+	db, err := openBadger(path, false)
+	if err == nil {
+		return initBadgerStore(db, false)
+	}
+	if !isLockError(err) {
+		return nil, err
+	}
+	log.Printf("the database is locked, opening it read-only: %v", err)
+	db, readOnlyErr := openBadger(path, true)
+	if readOnlyErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStoreLocked, err)
+	}
+	return initBadgerStore(db, true)
+}
+
+// OpenReadOnlyBadgerStore opens an existing database read-only, it can be shared with other read-only processes
+func OpenReadOnlyBadgerStore(path string) (*BadgerStore, error) {
+	db, err := openBadger(path, true)
+	if err != nil {
+		return nil, err
+	}
+	return initBadgerStore(db, true)
+}
+
+func initBadgerStore(db *badger.DB, readOnly bool) (*BadgerStore, error) {
+	store := newBadgerStore(db, readOnly)
+	err := migrateSchema(store)
+	if err == ErrStoreReadOnly {
+		err = fmt.Errorf("%w: the cache has to be upgraded by the process using it", ErrStoreLocked)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func openBadger(path string, readOnly bool) (*badger.DB, error) {
+	opts := badger.DefaultOptions(path).WithReadOnly(readOnly)
+	// TODO: set up proper logging for badger
+	opts.Logger = nil
+	return badger.Open(opts)
+}
+
+func newBadgerStore(db *badger.DB, readOnly bool) *BadgerStore {
+	store := &BadgerStore{db: db, readOnly: readOnly}
+	store.records = records{store}
+	return store
+}
+
+// badger does not export the error of a locked directory
+func isLockError(err error) bool {
+	return strings.Contains(err.Error(), "Cannot acquire directory lock")
+}
+
+func (s *BadgerStore) get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotCached
+	}
+	return value, err
+}
+
+func (s *BadgerStore) set(key string, value []byte) error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+}
+
+func (s *BadgerStore) delete(key string) error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+func (s *BadgerStore) writeBatch(set map[string][]byte, deleted []string) error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, key := range deleted {
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for key, value := range set {
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BadgerStore) scan(prefix string, fn func(key string, value []byte) error) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		iterator := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iterator.Close()
+		for iterator.Seek([]byte(prefix)); iterator.ValidForPrefix([]byte(prefix)); iterator.Next() {
+			item := iterator.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(string(item.KeyCopy(nil)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == errStopScan {
+		return nil
+	}
+	return err
+}
+
+// Size returns the size of the records, the files of badger are preallocated and way bigger
+func (s *BadgerStore) Size() int64 {
+	size := int64(0)
+	s.db.View(func(txn *badger.Txn) error {
+		iterator := txn.NewIterator(badger.IteratorOptions{})
+		defer iterator.Close()
+		for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+			size += iterator.Item().EstimatedSize()
+		}
+		return nil
+	})
+	return size
+}
+
+// Compact runs the value log GC until there is nothing left to rewrite
+func (s *BadgerStore) Compact() error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+	for {
+		err := s.db.RunValueLogGC(BADGER_GC_DISCARD_RATIO)
+		if err == badger.ErrNoRewrite {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *BadgerStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+func (s *BadgerStore) Close() error {
+	return s.db.Close()
+}
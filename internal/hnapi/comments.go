@@ -0,0 +1,85 @@
+package hnapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type CommentNode struct {
+	Item     *Item
+	Depth    int
+	Children []*CommentNode
+}
+
+// IsRemoved returns true if the comment was deleted or killed
+func (n *CommentNode) IsRemoved() bool {
+	return n.Item.IsDeleted || n.Item.IsDead
+}
+
+/*
+GetCommentTree returns the item with its comments walking the kids concurrently
+up to maxDepth levels (0 means no limit). The comments that could not be fetched
+are left out of the tree and their errors are returned joined along with the tree.
+When ctx is done the walk stops and only the error of the context is returned.
+*/
+func (r *Repository) GetCommentTree(ctx context.Context, storyId int, maxDepth int) (*CommentNode, error) {
+	story, err := r.GetItem(ctx, storyId)
+	if err != nil {
+		return nil, err
+	}
+	walker := commentWalker{
+		ctx:       ctx,
+		repo:      r,
+		maxDepth:  maxDepth,
+		semaphore: make(chan struct{}, MAX_ITEM_GET_WORKERS),
+	}
+	root := &CommentNode{Item: story, Depth: 0}
+	walker.walk(root)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return root, errors.Join(walker.errors...)
+}
+
+type commentWalker struct {
+	ctx       context.Context
+	repo      *Repository
+	maxDepth  int
+	semaphore chan struct{} // limits the number of concurrent item fetches
+	mutex     sync.Mutex
+	errors    []error
+}
+
+func (w *commentWalker) walk(node *CommentNode) {
+	if w.maxDepth > 0 && node.Depth >= w.maxDepth {
+		return
+	}
+	children := make([]*CommentNode, len(node.Item.Kids))
+	wg := sync.WaitGroup{}
+	for i, kidId := range node.Item.Kids {
+		wg.Go(func() {
+			select {
+			case w.semaphore <- struct{}{}:
+			case <-w.ctx.Done():
+				return
+			}
+			kid, err := w.repo.GetItem(w.ctx, kidId)
+			<-w.semaphore
+			if err != nil {
+				w.mutex.Lock()
+				w.errors = append(w.errors, err)
+				w.mutex.Unlock()
+				return
+			}
+			children[i] = &CommentNode{Item: kid, Depth: node.Depth + 1}
+			w.walk(children[i])
+		})
+	}
+	wg.Wait()
+	for _, child := range children {
+		if child != nil {
+			node.Children = append(node.Children, child)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package hnapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound is returned when the API responds with null for an item or user
+var ErrNotFound = errors.New("not found")
+
+// ErrCircuitOpen is returned without sending a request while the API is considered to be down
+var ErrCircuitOpen = errors.New("circuit breaker is open, the hacker-news API seems to be down")
+
+/*
+StatusError is returned when the API responds with an unexpected status code
+*/
+type StatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.StatusCode, e.Url)
+}
+
+// Temporary returns true if the request is worth retrying later
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+/*
+RequestError is returned when a request failed even after retrying it
+*/
+type RequestError struct {
+	Url      string
+	Attempts int
+	Err      error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request to %s failed after %d attempt(s): %v", e.Url, e.Attempts, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// IsTemporary returns true if the error is a transient failure of the API or of the network
+func IsTemporary(err error) bool {
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		return statusError.Temporary()
+	}
+	return errors.Is(err, ErrCircuitOpen) || isNetworkError(err)
+}
+
+/*
+ItemError is the error of an item that could not be fetched
+*/
+type ItemError struct {
+	Id  int
+	Err error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Id, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,51 @@
+package hnapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Feed int
+
+const (
+	FeedTop Feed = iota
+	FeedNew
+	FeedBest
+	FeedAsk
+	FeedShow
+	FeedJob
+)
+
+// Feeds lists every story feed served by the Hacker News API
+var Feeds = [...]Feed{FeedTop, FeedNew, FeedBest, FeedAsk, FeedShow, FeedJob}
+
+var feedNames = map[Feed]string{
+	FeedTop:  "top",
+	FeedNew:  "new",
+	FeedBest: "best",
+	FeedAsk:  "ask",
+	FeedShow: "show",
+	FeedJob:  "job",
+}
+
+/*
+ParseFeed returns the feed for a name like "top" or "topstories"
+*/
+func ParseFeed(name string) (Feed, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), "stories")
+	for feed, feedName := range feedNames {
+		if feedName == name {
+			return feed, nil
+		}
+	}
+	return FeedTop, fmt.Errorf("unknown feed \"%s\"", name)
+}
+
+func (f Feed) String() string {
+	return feedNames[f]
+}
+
+// Path returns the feed's path relative to the API base url
+func (f Feed) Path() string {
+	return fmt.Sprintf("%sstories.json", f.String())
+}
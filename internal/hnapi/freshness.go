@@ -0,0 +1,59 @@
+package hnapi
+
+import (
+	"time"
+)
+
+/*
+CachedItem is an item as stored in the cache along with the time it was fetched at
+*/
+type CachedItem struct {
+	Item      *Item `json:"item"`
+	FetchedAt int64 `json:"fetched_at"` // unix time
+}
+
+func (c *CachedItem) FetchedTime() time.Time {
+	return time.Unix(c.FetchedAt, 0)
+}
+
+/*
+FreshnessRule sets how long the cached copies of the items younger than MaxItemAge are fresh
+*/
+type FreshnessRule struct {
+	MaxItemAge time.Duration
+	TTL        time.Duration
+}
+
+/*
+FreshnessPolicy decides when a cached item has to be refetched based on the age of the item.
+The first rule matching the age is applied, the items older than every rule are never refetched.
+*/
+type FreshnessPolicy []FreshnessRule
+
+// DefaultFreshnessPolicy refreshes the recent stories often while their scores and comments change quickly
+var DefaultFreshnessPolicy = FreshnessPolicy{
+	{MaxItemAge: time.Hour * 2, TTL: time.Minute},
+	{MaxItemAge: time.Hour * 24, TTL: time.Minute * 10},
+	{MaxItemAge: time.Hour * 24 * 3, TTL: time.Hour},
+	{MaxItemAge: time.Hour * 24 * 14, TTL: time.Hour * 12},
+}
+
+// TTL returns how long the cached copy of the item is fresh, immutable is true if it never expires
+func (p FreshnessPolicy) TTL(item *Item, now time.Time) (ttl time.Duration, immutable bool) {
+	itemAge := now.Sub(time.Unix(int64(item.Time), 0))
+	for _, rule := range p {
+		if itemAge < rule.MaxItemAge {
+			return rule.TTL, false
+		}
+	}
+	return 0, true
+}
+
+// IsFresh returns true if the cached item can be used without refetching it
+func (p FreshnessPolicy) IsFresh(cached *CachedItem, now time.Time) bool {
+	if cached.Item.IsDeleted { // deleted items never come back
+		return true
+	}
+	ttl, immutable := p.TTL(cached.Item, now)
+	return immutable || now.Sub(cached.FetchedTime()) < ttl
+}
@@ -0,0 +1,36 @@
+package hnapi_test
+
+import (
+	"hnterminal/internal/hnapi"
+	"testing"
+	"time"
+)
+
+func Test_FreshnessPolicy_IsFresh(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	cachedAt := func(itemAge, cacheAge time.Duration) *hnapi.CachedItem {
+		item := &hnapi.Item{Time: int(now.Add(-itemAge).Unix())}
+		return &hnapi.CachedItem{Item: item, FetchedAt: now.Add(-cacheAge).Unix()}
+	}
+	cases := []struct {
+		name     string
+		cached   *hnapi.CachedItem
+		expected bool
+	}{
+		{"new item fetched now", cachedAt(time.Minute*10, 0), true},
+		{"new item fetched long ago", cachedAt(time.Minute*10, time.Minute*5), false},
+		{"day old item", cachedAt(time.Hour*10, time.Minute*5), true},
+		{"week old item", cachedAt(time.Hour*24*7, time.Hour*13), false},
+		{"month old item", cachedAt(time.Hour*24*30, time.Hour*24*29), true},
+	}
+	for _, c := range cases {
+		if fresh := hnapi.DefaultFreshnessPolicy.IsFresh(c.cached, now); fresh != c.expected {
+			t.Errorf("%s: expected fresh to be %t, got %t", c.name, c.expected, fresh)
+		}
+	}
+	deleted := cachedAt(time.Minute, time.Hour)
+	deleted.Item.IsDeleted = true
+	if !hnapi.DefaultFreshnessPolicy.IsFresh(deleted, now) {
+		t.Errorf("Expected a deleted item to stay fresh")
+	}
+}
@@ -0,0 +1,256 @@
+package hntest
+
+import (
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const SEARCH_API_PREFIX = "/api/v1/"
+
+// SearchUrl returns the url to be passed to hnapi.NewSearchClient
+func (s *Server) SearchUrl() string {
+	return s.URL + SEARCH_API_PREFIX
+}
+
+/*
+handleSearch serves the served items like the Algolia HN search API. The words of the query
+must all appear in the title, text, url or author of a hit, search sorts the hits by points
+instead of relevance and search_by_date by time.
+*/
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request, path string) {
+	switch {
+	case path == "search" || path == "search_by_date":
+		response, err := s.search(r, path == "search_by_date")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.writeJSON(w, response)
+	case strings.HasPrefix(path, "items/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "items/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.mutex.Lock()
+		item := s.searchItem(id)
+		s.mutex.Unlock()
+		if item == nil {
+			http.Error(w, `{"error":"Not found"}`, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, item)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) search(r *http.Request, byDate bool) (*hnapi.SearchResponse, error) {
+	params := r.URL.Query()
+	page, _ := strconv.Atoi(params.Get("page"))
+	hitsPerPage, err := strconv.Atoi(params.Get("hitsPerPage"))
+	if err != nil || hitsPerPage <= 0 {
+		hitsPerPage = hnapi.DEFAULT_HITS_PER_PAGE
+	}
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(params.Get("query"), "\"", " ")))
+	var tags []string
+	if params.Get("tags") != "" {
+		tags = strings.Split(params.Get("tags"), ",")
+	}
+	var filters []string
+	if params.Get("numericFilters") != "" {
+		filters = strings.Split(params.Get("numericFilters"), ",")
+	}
+
+	s.mutex.Lock()
+	hits := make([]*hnapi.SearchHit, 0)
+	for _, item := range s.items {
+		if item.IsDeleted || item.IsDead {
+			continue
+		}
+		hit := s.searchHit(item)
+		matches, err := matchesSearch(hit, words, tags, filters)
+		if err != nil {
+			s.mutex.Unlock()
+			return nil, err
+		}
+		if matches {
+			hits = append(hits, hit)
+		}
+	}
+	s.mutex.Unlock()
+
+	slices.SortFunc(hits, func(a, b *hnapi.SearchHit) int {
+		if !byDate && a.Points != b.Points {
+			return b.Points - a.Points
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return int(b.CreatedAt - a.CreatedAt)
+		}
+		return b.Id() - a.Id()
+	})
+	response := &hnapi.SearchResponse{
+		Hits:        []*hnapi.SearchHit{},
+		Page:        page,
+		Pages:       (len(hits) + hitsPerPage - 1) / hitsPerPage,
+		HitsCount:   len(hits),
+		HitsPerPage: hitsPerPage,
+	}
+	if start := page * hitsPerPage; start < len(hits) {
+		response.Hits = hits[start:min(start+hitsPerPage, len(hits))]
+	}
+	return response, nil
+}
+
+// returns the hit of the item with its tags, the mutex must be held
+func (s *Server) searchHit(item hnapi.Item) *hnapi.SearchHit {
+	hit := &hnapi.SearchHit{
+		ObjectId:    strconv.Itoa(item.Id),
+		CreatedAt:   int64(item.Time),
+		Author:      item.By,
+		Tags:        []string{item.Type, hnapi.AuthorTag(item.By)},
+		Points:      item.Score,
+		NumComments: item.CommentsCount,
+	}
+	if item.Type == "comment" {
+		hit.CommentText = item.Text
+		hit.ParentId = item.Parent
+		story := s.rootStory(item)
+		hit.StoryId = story.Id
+		hit.StoryTitle = story.Title
+		hit.Points = 0
+		hit.NumComments = 0
+	} else {
+		hit.Title = item.Title
+		hit.Url = item.Url
+		hit.StoryText = item.Text
+		hit.StoryId = item.Id
+	}
+	hit.Tags = append(hit.Tags, hnapi.StoryTag(hit.StoryId))
+	switch {
+	case strings.HasPrefix(item.Title, "Ask HN:"):
+		hit.Tags = append(hit.Tags, hnapi.TAG_ASK_HN)
+	case strings.HasPrefix(item.Title, "Show HN:"):
+		hit.Tags = append(hit.Tags, hnapi.TAG_SHOW_HN)
+	}
+	if slices.Contains(s.feeds["top"], item.Id) {
+		hit.Tags = append(hit.Tags, hnapi.TAG_FRONT_PAGE)
+	}
+	return hit
+}
+
+// returns the story of the comment, the mutex must be held
+func (s *Server) rootStory(item hnapi.Item) hnapi.Item {
+	for item.Parent != 0 {
+		parent, ok := s.items[item.Parent]
+		if !ok {
+			break
+		}
+		item = parent
+	}
+	return item
+}
+
+// returns the item with its tree of comments, the mutex must be held
+func (s *Server) searchItem(id int) *hnapi.SearchItem {
+	item, ok := s.items[id]
+	if !ok {
+		return nil
+	}
+	searchItem := &hnapi.SearchItem{
+		Id:        item.Id,
+		CreatedAt: int64(item.Time),
+		Type:      item.Type,
+		Author:    item.By,
+		Title:     item.Title,
+		Url:       item.Url,
+		Text:      item.Text,
+		Points:    item.Score,
+		ParentId:  item.Parent,
+		StoryId:   s.rootStory(item).Id,
+		Children:  []*hnapi.SearchItem{},
+	}
+	for _, kid := range item.Kids {
+		if child := s.searchItem(kid); child != nil {
+			searchItem.Children = append(searchItem.Children, child)
+		}
+	}
+	return searchItem
+}
+
+// the tags in parentheses are alternatives, e.g. "(story,comment)"
+func matchesSearch(hit *hnapi.SearchHit, words []string, tags []string, filters []string) (bool, error) {
+	content := strings.ToLower(strings.Join([]string{hit.Title, hit.Url, hit.Author, hit.StoryText, hit.CommentText}, " "))
+	for _, word := range words {
+		if !strings.Contains(content, word) {
+			return false, nil
+		}
+	}
+	alternatives := false
+	matchedAlternative := false
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "(") {
+			alternatives = true
+			matchedAlternative = false
+		}
+		matched := slices.Contains(hit.Tags, strings.Trim(tag, "()"))
+		if !alternatives && !matched {
+			return false, nil
+		}
+		matchedAlternative = matchedAlternative || matched
+		if strings.HasSuffix(tag, ")") {
+			if !matchedAlternative {
+				return false, nil
+			}
+			alternatives = false
+		}
+	}
+	for _, filter := range filters {
+		matched, err := matchesNumericFilter(hit, filter)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchesNumericFilter(hit *hnapi.SearchHit, filter string) (bool, error) {
+	for _, operator := range []string{">=", "<=", ">", "<", "="} {
+		field, value, ok := strings.Cut(filter, operator)
+		if !ok {
+			continue
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid numeric filter %s", filter)
+		}
+		var actual int64
+		switch field {
+		case "points":
+			actual = int64(hit.Points)
+		case "num_comments":
+			actual = int64(hit.NumComments)
+		case "created_at_i":
+			actual = hit.CreatedAt
+		default:
+			return false, fmt.Errorf("unknown numeric attribute %s", field)
+		}
+		switch operator {
+		case ">=":
+			return actual >= limit, nil
+		case "<=":
+			return actual <= limit, nil
+		case ">":
+			return actual > limit, nil
+		case "<":
+			return actual < limit, nil
+		default:
+			return actual == limit, nil
+		}
+	}
+	return false, fmt.Errorf("invalid numeric filter %s", filter)
+}
@@ -0,0 +1,354 @@
+/*
+Package hntest provides an in-process fake of the Hacker News Firebase API and of the Algolia
+search API for tests
+*/
+package hntest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const API_PREFIX = "/v0/"
+
+//go:embed testdata/fixtures.json
+var defaultFixtures []byte
+
+/*
+Fixtures is the data served by the fake server
+*/
+type Fixtures struct {
+	Feeds   map[string][]int `json:"feeds"`
+	Items   []hnapi.Item     `json:"items"`
+	Users   []hnapi.User     `json:"users"`
+	MaxItem int              `json:"maxitem"`
+	Updates hnapi.Updates    `json:"updates"`
+}
+
+type Server struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	feeds    map[string][]int
+	items    map[int]hnapi.Item
+	users    map[string]hnapi.User
+	maxItem  int
+	updates  hnapi.Updates
+	latency  time.Duration
+	failures map[string][]int // statuses to respond with on the next requests of a path
+	requests map[string]int
+	streams  map[*eventStream]bool
+	closed   chan struct{}
+}
+
+// an open server-sent events connection
+type eventStream struct {
+	path   string // e.g. "topstories" or "item/100"
+	events chan string
+	closed chan struct{}
+}
+
+/*
+NewServer starts an empty fake server, it has to be closed by the caller
+*/
+func NewServer() *Server {
+	s := &Server{
+		feeds:    make(map[string][]int),
+		items:    make(map[int]hnapi.Item),
+		users:    make(map[string]hnapi.User),
+		failures: make(map[string][]int),
+		requests: make(map[string]int),
+		streams:  make(map[*eventStream]bool),
+		closed:   make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+/*
+NewServerWithFixtures starts a fake server serving the bundled fixtures
+*/
+func NewServerWithFixtures() *Server {
+	s := NewServer()
+	if err := s.LoadFixtures(strings.NewReader(string(defaultFixtures))); err != nil {
+		panic(fmt.Sprintf("invalid bundled fixtures: %v", err))
+	}
+	return s
+}
+
+// Close ends the open event streams and shuts down the server
+func (s *Server) Close() {
+	close(s.closed)
+	s.Server.Close()
+}
+
+// BaseUrl returns the url to be passed to hnapi.NewApiClient
+func (s *Server) BaseUrl() string {
+	return s.URL + API_PREFIX
+}
+
+// LoadFixtures adds the fixtures read as JSON from r to the served data
+func (s *Server) LoadFixtures(r io.Reader) error {
+	var fixtures Fixtures
+	if err := json.NewDecoder(r).Decode(&fixtures); err != nil {
+		return err
+	}
+	for feed, ids := range fixtures.Feeds {
+		s.SetFeed(feed, ids...)
+	}
+	s.AddItems(fixtures.Items...)
+	s.AddUsers(fixtures.Users...)
+	s.mutex.Lock()
+	s.maxItem = max(s.maxItem, fixtures.MaxItem)
+	s.mutex.Unlock()
+	s.SetUpdates(fixtures.Updates.Items, fixtures.Updates.Profiles)
+	return nil
+}
+
+// SetFeed sets the ids of a feed, the name is like "top" or "new"
+func (s *Server) SetFeed(feed string, ids ...int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.feeds[strings.TrimSuffix(feed, "stories")] = ids
+}
+
+func (s *Server) AddItems(items ...hnapi.Item) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, item := range items {
+		s.items[item.Id] = item
+		s.maxItem = max(s.maxItem, item.Id)
+	}
+}
+
+// Item returns the served item, used to modify it in tests
+func (s *Server) Item(id int) (hnapi.Item, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	item, ok := s.items[id]
+	return item, ok
+}
+
+func (s *Server) AddUsers(users ...hnapi.User) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, user := range users {
+		s.users[user.Id] = user
+	}
+}
+
+func (s *Server) SetMaxItem(id int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxItem = id
+}
+
+func (s *Server) SetUpdates(items []int, profiles []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updates = hnapi.Updates{Items: items, Profiles: profiles}
+}
+
+// SetLatency delays every response by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latency = d
+}
+
+/*
+FailNext makes the next requests of the path (e.g. "item/1.json") respond with the
+given statuses in order, the requests after them are served normally again
+*/
+func (s *Server) FailNext(path string, statuses ...int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[path] = append(s.failures[path], statuses...)
+}
+
+// RequestCount returns how many requests the path (e.g. "topstories.json") received
+func (s *Server) RequestCount(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, API_PREFIX)
+	searchPath, isSearch := strings.CutPrefix(r.URL.Path, SEARCH_API_PREFIX)
+	if !ok && !isSearch {
+		http.NotFound(w, r)
+		return
+	}
+	if isSearch {
+		path = searchPath
+	}
+	s.mutex.Lock()
+	s.requests[path]++
+	latency := s.latency
+	status := http.StatusOK
+	if failures := s.failures[path]; len(failures) > 0 {
+		status = failures[0]
+		s.failures[path] = failures[1:]
+	}
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if isSearch {
+		s.handleSearch(w, r, path)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.handleStream(w, r, path)
+		return
+	}
+	s.writeJSON(w, s.resolve(path))
+}
+
+/*
+handleStream sends the current value of the path as a put event like Firebase does,
+then the events emitted for the path until the client or the server closes the stream
+*/
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, path string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	stream := &eventStream{strings.TrimSuffix(path, ".json"), make(chan string, 64), make(chan struct{})}
+	initial := formatEvent("put", "/", s.resolve(path))
+	s.mutex.Lock()
+	s.streams[stream] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.streams, stream)
+		s.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, initial)
+	flusher.Flush()
+	for {
+		select {
+		case event := <-stream.events:
+			io.WriteString(w, event)
+			flusher.Flush()
+		case <-stream.closed:
+			return
+		case <-s.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func formatEvent(eventType string, dataPath string, data any) string {
+	payload, _ := json.Marshal(map[string]any{"path": dataPath, "data": data})
+	if eventType == "put" || eventType == "patch" {
+		return fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, payload)
+	}
+	return fmt.Sprintf("event: %s\ndata: null\n\n", eventType)
+}
+
+/*
+Emit sends an event (put, patch, keep-alive, cancel) to the open streams of the path
+(e.g. "topstories" or "item/100"), dataPath and data are the payload of put and patch events
+*/
+func (s *Server) Emit(path string, eventType string, dataPath string, data any) {
+	event := formatEvent(eventType, dataPath, data)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for stream := range s.streams {
+		if stream.path == path {
+			select {
+			case stream.events <- event:
+			default: // the client is not reading the stream
+			}
+		}
+	}
+}
+
+// StreamCount returns the number of open streams of the path (e.g. "topstories")
+func (s *Server) StreamCount(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := 0
+	for stream := range s.streams {
+		if stream.path == path {
+			count++
+		}
+	}
+	return count
+}
+
+// CloseStreams drops all the open event streams, e.g. to test reconnecting
+func (s *Server) CloseStreams() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for stream := range s.streams {
+		close(stream.closed)
+		delete(s.streams, stream)
+	}
+}
+
+// returns the value served on the path, nil is served as null like Firebase does
+func (s *Server) resolve(path string) any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name, ok := strings.CutSuffix(path, ".json")
+	if !ok {
+		return nil
+	}
+	switch {
+	case name == "maxitem":
+		return s.maxItem
+	case name == "updates":
+		return s.updates
+	case strings.HasPrefix(name, "item/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "item/"))
+		if err != nil {
+			return nil
+		}
+		if item, ok := s.items[id]; ok {
+			return item
+		}
+	case strings.HasPrefix(name, "user/"):
+		if user, ok := s.users[strings.TrimPrefix(name, "user/")]; ok {
+			return user
+		}
+	case strings.HasSuffix(name, "stories"):
+		if ids, ok := s.feeds[strings.TrimSuffix(name, "stories")]; ok {
+			return ids
+		}
+	}
+	return nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
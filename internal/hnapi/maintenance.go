@@ -0,0 +1,277 @@
+package hnapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the maximum size of a line of an export, the biggest records are users with many submissions
+const MAX_EXPORT_LINE_SIZE = 16 * 1024 * 1024
+
+// ErrInvalidExport is returned when importing something that is not an export of the cache
+var ErrInvalidExport = errors.New("invalid export")
+
+/*
+CacheStats describes the content of the cache, the oldest and newest items are by their fetch time
+*/
+type CacheStats struct {
+	Items      int
+	Users      int
+	Feeds      int
+	Visits     int
+	Saved      int
+	Size       int64
+	OldestItem time.Time
+	NewestItem time.Time
+}
+
+func (r *Repository) CacheStats() (*CacheStats, error) {
+	stats := &CacheStats{Size: r.store.Size()}
+	err := r.store.Scan(ITEM_KEY_PREFIX, func(key string, value []byte) error {
+		var cached CachedItem
+		if err := json.Unmarshal(value, &cached); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		stats.Items++
+		fetchedAt := cached.FetchedTime()
+		if stats.OldestItem.IsZero() || fetchedAt.Before(stats.OldestItem) {
+			stats.OldestItem = fetchedAt
+		}
+		if fetchedAt.After(stats.NewestItem) {
+			stats.NewestItem = fetchedAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.store.Scan(USER_KEY_PREFIX, func(key string, value []byte) error {
+		stats.Users++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.store.Scan(FEED_KEY_PREFIX, func(key string, value []byte) error {
+		stats.Feeds++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.store.Scan(VISIT_KEY_PREFIX, func(key string, value []byte) error {
+		stats.Visits++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.store.Scan(SAVED_KEY_PREFIX, func(key string, value []byte) error {
+		stats.Saved++
+		return nil
+	})
+	return stats, err
+}
+
+/*
+GCOptions selects the items removed by GC. The items fetched more than MaxAge ago are removed
+(0 keeps them), with Unlinked every item is removed but the ones linked to the saved items and
+to the Keep stories. The saved items, the Keep stories and their comments are never removed.
+*/
+type GCOptions struct {
+	MaxAge   time.Duration
+	Unlinked bool
+	Keep     []int
+}
+
+type GCReport struct {
+	Removed    int
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+/*
+GC removes the items selected by the options from the cache and reclaims their space
+*/
+func (r *Repository) GC(options GCOptions) (*GCReport, error) {
+	if r.store.ReadOnly() {
+		return nil, ErrStoreReadOnly
+	}
+	report := &GCReport{SizeBefore: r.store.Size()}
+	savedItems, err := r.SavedItems()
+	if err != nil {
+		return nil, err
+	}
+	keep := slices.Clone(options.Keep)
+	for _, saved := range savedItems {
+		keep = append(keep, saved.Id)
+	}
+	kept := r.linkedItems(keep)
+	expired := time.Now().Add(-options.MaxAge)
+	removed := make([]int, 0)
+	err = r.store.Scan(ITEM_KEY_PREFIX, func(key string, value []byte) error {
+		id, err := strconv.Atoi(strings.TrimPrefix(key, ITEM_KEY_PREFIX))
+		if err != nil || kept[id] {
+			return nil
+		}
+		if options.Unlinked {
+			removed = append(removed, id)
+			return nil
+		}
+		var cached CachedItem
+		if err := json.Unmarshal(value, &cached); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if options.MaxAge > 0 && cached.FetchedTime().Before(expired) {
+			removed = append(removed, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range removed {
+		if err := r.store.Delete(itemKey(id)); err != nil {
+			return nil, err
+		}
+		r.memoryCache.Remove(id)
+		r.indexItem(&Item{Id: id, IsDeleted: true})
+		report.Removed++
+	}
+	if err := r.store.Compact(); err != nil {
+		return nil, err
+	}
+	report.SizeAfter = r.store.Size()
+	return report, nil
+}
+
+// returns the ids of the cached stories and of their cached comments
+func (r *Repository) linkedItems(storyIds []int) map[int]bool {
+	linked := make(map[int]bool)
+	pending := append([]int{}, storyIds...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if linked[id] {
+			continue
+		}
+		linked[id] = true
+		if cached, err := r.store.LoadItem(id); err == nil {
+			pending = append(pending, cached.Item.Kids...)
+		}
+	}
+	return linked
+}
+
+// a line of an export
+type exportRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+/*
+Export writes the items, users, feeds, visits and saved items of the cache as JSON lines, starting with the schema version.
+It returns the number of records written.
+*/
+func (r *Repository) Export(w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(exportRecord{metaKey(SCHEMA_VERSION_KEY), schemaVersionValue(SCHEMA_VERSION)}); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, prefix := range []string{ITEM_KEY_PREFIX, USER_KEY_PREFIX, FEED_KEY_PREFIX, VISIT_KEY_PREFIX, SAVED_KEY_PREFIX} {
+		err := r.store.Scan(prefix, func(key string, value []byte) error {
+			count++
+			return encoder.Encode(exportRecord{key, value})
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+type ImportReport struct {
+	Imported int
+	Skipped  int // the items whose cached version was fetched later than the imported one
+}
+
+/*
+Import reads an export into the cache, the records of the cache are overwritten
+unless they are items fetched later than the imported ones
+*/
+func (r *Repository) Import(reader io.Reader) (*ImportReport, error) {
+	if r.store.ReadOnly() {
+		return nil, ErrStoreReadOnly
+	}
+	report := &ImportReport{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_EXPORT_LINE_SIZE)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var record exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return report, fmt.Errorf("%w: line %d: %v", ErrInvalidExport, line, err)
+		}
+		if line == 1 {
+			if record.Key != metaKey(SCHEMA_VERSION_KEY) {
+				return report, fmt.Errorf("%w: the schema version is missing", ErrInvalidExport)
+			}
+			if version := string(record.Value); version != string(schemaVersionValue(SCHEMA_VERSION)) {
+				return report, fmt.Errorf("%w: schema version %s, expected %d", ErrInvalidExport, version, SCHEMA_VERSION)
+			}
+			continue
+		}
+		imported, err := r.importRecord(record)
+		if err != nil {
+			return report, fmt.Errorf("line %d: %w", line, err)
+		}
+		if imported {
+			report.Imported++
+		} else {
+			report.Skipped++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+	if line == 0 {
+		return report, fmt.Errorf("%w: empty", ErrInvalidExport)
+	}
+	return report, nil
+}
+
+func (r *Repository) importRecord(record exportRecord) (bool, error) {
+	switch {
+	case strings.HasPrefix(record.Key, ITEM_KEY_PREFIX):
+		var imported CachedItem
+		if err := json.Unmarshal(record.Value, &imported); err != nil || imported.Item == nil {
+			return false, fmt.Errorf("%w: invalid item %s", ErrInvalidExport, record.Key)
+		}
+		if record.Key != itemKey(imported.Item.Id) {
+			return false, fmt.Errorf("%w: item %d under %s", ErrInvalidExport, imported.Item.Id, record.Key)
+		}
+		if cached, err := r.store.LoadItem(imported.Item.Id); err == nil && cached.FetchedAt > imported.FetchedAt {
+			return false, nil
+		}
+		r.memoryCache.Remove(imported.Item.Id)
+		if err := r.store.Set(record.Key, record.Value); err != nil {
+			return false, err
+		}
+		r.indexItem(imported.Item)
+		return true, nil
+	case strings.HasPrefix(record.Key, USER_KEY_PREFIX), strings.HasPrefix(record.Key, FEED_KEY_PREFIX),
+		strings.HasPrefix(record.Key, VISIT_KEY_PREFIX), strings.HasPrefix(record.Key, SAVED_KEY_PREFIX):
+	default:
+		return false, fmt.Errorf("%w: unexpected key %s", ErrInvalidExport, record.Key)
+	}
+	return true, r.store.Set(record.Key, record.Value)
+}
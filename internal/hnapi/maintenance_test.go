@@ -0,0 +1,102 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Repository_CacheStats(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.GetCommentTree(context.Background(), 100, 0)
+	repo.GetUser(context.Background(), "alice")
+	repo.GetFeedIds(context.Background(), hnapi.FeedTop)
+
+	stats, err := repo.CacheStats()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Items != 5 || stats.Users != 1 || stats.Feeds != 1 {
+		t.Errorf("Expected 5 items, 1 user and 1 feed, got %d, %d and %d", stats.Items, stats.Users, stats.Feeds)
+	}
+	if stats.Size == 0 || time.Since(stats.OldestItem) > time.Minute {
+		t.Errorf("Expected the size and the fetch times, got %d and %v", stats.Size, stats.OldestItem)
+	}
+}
+
+func Test_Repository_GC(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.GetCommentTree(context.Background(), 100, 0)
+	for _, id := range []int{200, 300} {
+		item, _ := repo.GetItem(context.Background(), id)
+		repo.Store().SaveItem(&hnapi.CachedItem{Item: item, FetchedAt: time.Now().Add(-time.Hour * 48).Unix()})
+	}
+
+	report, err := repo.GC(hnapi.GCOptions{MaxAge: time.Hour * 24, Keep: []int{300}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Removed != 1 {
+		t.Errorf("Expected 1 removed item, got %d", report.Removed)
+	}
+	if _, err := repo.LoadItemFromCache(200); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected the old item to be removed, got %v", err)
+	}
+
+	report, err = repo.GC(hnapi.GCOptions{Unlinked: true, Keep: []int{100}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Removed != 1 {
+		t.Errorf("Expected the unlinked item 300 to be removed, got %d removed", report.Removed)
+	}
+	if _, err := repo.LoadItemFromCache(103); err != nil {
+		t.Errorf("Expected the comments of the kept story to stay, got %v", err)
+	}
+}
+
+func Test_Repository_ExportImport(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.GetCommentTree(context.Background(), 100, 0)
+	repo.GetUser(context.Background(), "alice")
+
+	var exported strings.Builder
+	count, err := repo.Export(&exported)
+	if err != nil || count != 6 {
+		t.Fatalf("Expected 6 exported records, got %d, %v", count, err)
+	}
+
+	other := hnapi.NewRepositoryWithStore(nil, &config.Config{BaseUrl: server.BaseUrl()}, hnapi.NewMemoryStore())
+	defer other.Close()
+	report, err := other.Import(strings.NewReader(exported.String()))
+	if err != nil || report.Imported != 6 {
+		t.Fatalf("Expected 6 imported records, got %v, %v", report, err)
+	}
+	if user, err := other.LoadUserFromCache("alice"); err != nil || user.Karma != 4321 {
+		t.Errorf("Expected the imported user, got %v, %v", user, err)
+	}
+
+	// the items fetched later are kept
+	item, _ := other.LoadItemFromCache(101)
+	item.FetchedAt = time.Now().Add(time.Hour).Unix()
+	other.Store().SaveItem(item)
+	report, err = other.Import(strings.NewReader(exported.String()))
+	if err != nil || report.Skipped != 1 {
+		t.Errorf("Expected 1 skipped item, got %v, %v", report, err)
+	}
+
+	if _, err := other.Import(strings.NewReader("{\"key\":\"item/1\",\"value\":{}}\n")); !errors.Is(err, hnapi.ErrInvalidExport) {
+		t.Errorf("Expected ErrInvalidExport without the schema version, got %v", err)
+	}
+}
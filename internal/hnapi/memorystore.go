@@ -0,0 +1,103 @@
+package hnapi
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+/*
+MemoryStore keeps the records in memory only, for the tests and the runs that must not touch the disk
+*/
+type MemoryStore struct {
+	records
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{values: make(map[string][]byte)}
+	store.records = records{store}
+	store.set(metaKey(SCHEMA_VERSION_KEY), schemaVersionValue(SCHEMA_VERSION))
+	return store
+}
+
+func (s *MemoryStore) get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, ErrNotCached
+	}
+	return value, nil
+}
+
+func (s *MemoryStore) set(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.values[key] = slices.Clone(value)
+	return nil
+}
+
+func (s *MemoryStore) delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func (s *MemoryStore) writeBatch(set map[string][]byte, deleted []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range deleted {
+		delete(s.values, key)
+	}
+	for key, value := range set {
+		s.values[key] = slices.Clone(value)
+	}
+	return nil
+}
+
+func (s *MemoryStore) scan(prefix string, fn func(key string, value []byte) error) error {
+	// fn may write to the store, it is called on a copy of the matching records
+	s.mutex.RLock()
+	matching := make(map[string][]byte)
+	for key, value := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			matching[key] = value
+		}
+	}
+	s.mutex.RUnlock()
+	for _, key := range slices.Sorted(maps.Keys(matching)) {
+		if err := fn(key, matching[key]); err != nil {
+			if err == errStopScan {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Size() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	size := 0
+	for key, value := range s.values {
+		size += len(key) + len(value)
+	}
+	return int64(size)
+}
+
+func (s *MemoryStore) Compact() error {
+	return nil
+}
+
+func (s *MemoryStore) ReadOnly() bool {
+	return false
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
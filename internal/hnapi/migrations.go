@@ -0,0 +1,116 @@
+package hnapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// the version of the layout of the records, a store with a lower version is migrated when opened
+const SCHEMA_VERSION = 1
+const SCHEMA_VERSION_KEY = "schema_version"
+
+// ErrSchemaTooNew is returned when the store was written by a newer version of the program
+var ErrSchemaTooNew = errors.New("the cache was written by a newer version, delete it or upgrade")
+
+/*
+Migration upgrades the records of a store from the previous schema version to Version
+*/
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(kv keyValues) error
+}
+
+// the migrations in the order of their versions, append a migration when changing the layout of the records
+var migrations = []Migration{
+	{1, "move the items under the item/ prefix and store them with their fetch time", migrateItemKeys},
+}
+
+func schemaVersionValue(version int) []byte {
+	return []byte(strconv.Itoa(version))
+}
+
+// returns the schema version of the store, -1 for an empty store
+func loadSchemaVersion(kv keyValues) (int, error) {
+	value, err := kv.get(metaKey(SCHEMA_VERSION_KEY))
+	if err == ErrNotCached {
+		empty := true
+		err := kv.scan("", func(key string, value []byte) error {
+			empty = false
+			return errStopScan
+		})
+		if err != nil || empty {
+			return -1, err
+		}
+		return 0, nil // the stores had no version before the first migration
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version \"%s\": %w", value, err)
+	}
+	return version, nil
+}
+
+/*
+migrateSchema runs the migrations the store is missing, saving the version after each of them
+so an interrupted upgrade continues with the failed migration
+*/
+func migrateSchema(kv keyValues) error {
+	version, err := loadSchemaVersion(kv)
+	if err != nil {
+		return err
+	}
+	if version == -1 { // nothing to migrate
+		return kv.set(metaKey(SCHEMA_VERSION_KEY), schemaVersionValue(SCHEMA_VERSION))
+	}
+	if version > SCHEMA_VERSION {
+		return fmt.Errorf("%w: schema version %d, expected %d", ErrSchemaTooNew, version, SCHEMA_VERSION)
+	}
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		log.Printf("migrating the cache to schema version %d: %s", migration.Version, migration.Description)
+		if err := migration.Migrate(kv); err != nil {
+			return fmt.Errorf("error while migrating the cache to schema version %d: %w", migration.Version, err)
+		}
+		if err := kv.set(metaKey(SCHEMA_VERSION_KEY), schemaVersionValue(migration.Version)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the items were stored under their bare ids either as items or as CachedItems
+func migrateItemKeys(kv keyValues) error {
+	return kv.scan("", func(key string, value []byte) error {
+		id, err := strconv.Atoi(key)
+		if err != nil { // not an item
+			return nil
+		}
+		var cached CachedItem
+		if err := json.Unmarshal(value, &cached); err != nil {
+			return fmt.Errorf("item %d: %w", id, err)
+		}
+		if cached.Item == nil {
+			cached.FetchedAt = 0 // unknown, it is refetched when the freshness policy requires it
+			if err := json.Unmarshal(value, &cached.Item); err != nil {
+				return fmt.Errorf("item %d: %w", id, err)
+			}
+		}
+		bytes, err := json.Marshal(cached)
+		if err != nil {
+			return err
+		}
+		if err := kv.set(itemKey(id), bytes); err != nil {
+			return err
+		}
+		return kv.delete(key)
+	})
+}
@@ -0,0 +1,94 @@
+package hnapi
+
+import (
+	"errors"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// writes the records to a new badger database without going through the store
+func writeRawBadger(t *testing.T, records map[string]string) string {
+	path := t.TempDir()
+	db, err := openBadger(path, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, value := range records {
+			if err := txn.Set([]byte(key), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return path
+}
+
+func Test_MigrateFromBareItemKeys(t *testing.T) {
+	path := writeRawBadger(t, map[string]string{
+		"100":        `{"id":100,"by":"alice","title":"A story","kids":[101]}`,
+		"101":        `{"item":{"id":101,"by":"bob","text":"A comment"},"fetched_at":1700000000}`,
+		"user/alice": `{"id":"alice","karma":4321}`,
+	})
+	store, err := OpenBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	story, err := store.LoadItem(100)
+	if err != nil || story.Item.Title != "A story" || story.Item.Kids[0] != 101 || story.FetchedAt != 0 {
+		t.Errorf("Expected the migrated story fetched at 0, got %v, %v", story, err)
+	}
+	comment, err := store.LoadItem(101)
+	if err != nil || comment.Item.Text != "A comment" || comment.FetchedAt != 1700000000 {
+		t.Errorf("Expected the migrated comment with its fetch time, got %v, %v", comment, err)
+	}
+	if user, err := store.LoadUser("alice"); err != nil || user.Karma != 4321 {
+		t.Errorf("Expected the user to be kept, got %v, %v", user, err)
+	}
+	if _, err := store.get("100"); err != ErrNotCached {
+		t.Errorf("Expected the bare key to be deleted, got %v", err)
+	}
+	if version, err := loadSchemaVersion(store); version != SCHEMA_VERSION {
+		t.Errorf("Expected schema version %d, got %d, %v", SCHEMA_VERSION, version, err)
+	}
+	store.Close()
+
+	// the migrated store is opened as is
+	store, err = OpenBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer store.Close()
+	if story, err := store.LoadItem(100); err != nil || story.Item.Id != 100 {
+		t.Errorf("Expected the migrated story, got %v, %v", story, err)
+	}
+}
+
+func Test_MigrateEmptyStore(t *testing.T) {
+	if version, err := loadSchemaVersion(NewMemoryStore()); version != SCHEMA_VERSION {
+		t.Errorf("Expected schema version %d, got %d, %v", SCHEMA_VERSION, version, err)
+	}
+	store, err := OpenBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer store.Close()
+	if version, err := loadSchemaVersion(store); version != SCHEMA_VERSION {
+		t.Errorf("Expected schema version %d, got %d, %v", SCHEMA_VERSION, version, err)
+	}
+}
+
+func Test_MigrateRejectsNewerSchema(t *testing.T) {
+	path := writeRawBadger(t, map[string]string{
+		metaKey(SCHEMA_VERSION_KEY): "1000",
+	})
+	if _, err := OpenBadgerStore(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
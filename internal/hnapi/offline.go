@@ -0,0 +1,104 @@
+package hnapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// how long the repository stays offline after a network failure before trying the network again
+const OFFLINE_RECHECK_INTERVAL = time.Minute
+
+/*
+SetOffline makes the repository serve the feeds, items and users only from the cache,
+the network is not used until it is unset
+*/
+func (r *Repository) SetOffline(offline bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.offline = offline
+	r.offlineUntil = time.Time{}
+}
+
+/*
+IsOffline returns true if the repository serves only the cached data, either because
+it was set offline or because the network failed recently
+*/
+func (r *Repository) IsOffline() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.offline || time.Now().Before(r.offlineUntil)
+}
+
+// switches to the offline mode for a while if the error is a network failure, returns true if it did
+func (r *Repository) detectOffline(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || !(isNetworkError(err) || errors.Is(err, ErrCircuitOpen)) {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.offline && time.Now().After(r.offlineUntil) {
+		log.Printf("the network seems to be down, serving the cache for %v: %v", OFFLINE_RECHECK_INTERVAL, err)
+	}
+	r.offlineUntil = time.Now().Add(OFFLINE_RECHECK_INTERVAL)
+	return true
+}
+
+/*
+GetFeed returns the ids of the feed and the time they were fetched at. Online the feed is
+fetched and its snapshot is saved, offline or when the network fails the last snapshot is returned.
+*/
+func (r *Repository) GetFeed(ctx context.Context, feed Feed) (*CachedFeed, error) {
+	if !r.IsOffline() {
+		ids, err := r.apiClient.GetFeedIds(ctx, feed)
+		if err == nil {
+			cached := &CachedFeed{ids, time.Now().Unix()}
+			if err := r.store.SaveFeed(feed, cached); err != nil && err != ErrStoreReadOnly {
+				log.Printf("error while saving the %s feed: %v", feed, err)
+			}
+			return cached, nil
+		}
+		if !r.detectOffline(ctx, err) {
+			return nil, err
+		}
+	}
+	cached, err := r.store.LoadFeed(feed)
+	if err == ErrNotCached {
+		return nil, fmt.Errorf("the %s feed was never fetched, it is not available offline: %w", feed, ErrNotCached)
+	}
+	return cached, err
+}
+
+/*
+GetUpdates returns the ids of the recently changed items and profiles. The updates are not
+cached, offline they are not available and a network failure switches to the offline mode.
+*/
+func (r *Repository) GetUpdates(ctx context.Context) (*Updates, error) {
+	if r.IsOffline() {
+		return nil, fmt.Errorf("the updates are not available offline: %w", ErrNotCached)
+	}
+	updates, err := r.apiClient.GetUpdates(ctx)
+	if err != nil {
+		r.detectOffline(ctx, err)
+		return nil, err
+	}
+	return updates, nil
+}
+
+/*
+GetMaxItem returns the id of the newest item. Like the updates it is not cached, offline it is
+not available and a network failure switches to the offline mode.
+*/
+func (r *Repository) GetMaxItem(ctx context.Context) (int, error) {
+	if r.IsOffline() {
+		return 0, fmt.Errorf("the max item is not available offline: %w", ErrNotCached)
+	}
+	maxItem, err := r.apiClient.GetMaxItem(ctx)
+	if err != nil {
+		r.detectOffline(ctx, err)
+		return 0, err
+	}
+	return maxItem, nil
+}
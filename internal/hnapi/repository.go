@@ -1,16 +1,24 @@
 package hnapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	config "hnterminal/internal/config"
+	"hnterminal/internal/utils"
+	"iter"
 	"log"
-	"strconv"
 	"sync"
-
-	badger "github.com/dgraph-io/badger/v4"
+	"time"
 )
 
-const MAX_ITEM_GET_BATCH_SIZE = 20
+const MAX_ITEM_GET_WORKERS = 20
+const ITEM_MEMORY_CACHE_SIZE = 2000
+
+// the number of saved items waiting to be indexed before the saves wait for the indexer
+const INDEX_QUEUE_SIZE = 1000
+const INDEX_BATCH_SIZE = 100
 
 type ItemIds []int
 type Item struct {
@@ -30,124 +38,560 @@ type Item struct {
 	IsDeleted     bool    `json:"deleted"`
 }
 type User struct {
-	Id        int `json:"id"`
-	CreadedAt int `json:"created_at"`
+	Id        string  `json:"id"`
+	CreatedAt int     `json:"created"`
+	Karma     int     `json:"karma"`
+	About     string  `json:"about"`
+	Submitted ItemIds `json:"submitted"`
+}
+type Updates struct {
+	Items    []int    `json:"items"`
+	Profiles []string `json:"profiles"`
+}
+
+/*
+ItemIndexer keeps an index of the cached items up to date, it is told in batches about every
+item saved to or removed from the cache, the removed items are given as deleted items
+*/
+type ItemIndexer interface {
+	IndexItems(items []*Item) error
 }
+
+// ItemListener is called with the refetched version of an item that was marked as updated or revalidated
+type ItemListener func(item *Item)
+
 type Repository struct {
-	db         *badger.DB
-	apiClient  *ApiClient
-	updatedIds map[int]bool
-	wg         *sync.WaitGroup
-	config     *config.Config
-}
-
-func NewRepository(apiClient *ApiClient, cfg *config.Config) *Repository {
-	opts := badger.DefaultOptions(cfg.DbPath)
-	// TODO: set up proper logging for badger
-	opts.Logger = nil
-	db, err := badger.Open(opts)
+	store        Store
+	apiClient    *ApiClient
+	updatedIds   map[int]bool
+	updatedUsers map[string]bool
+	listeners    []ItemListener
+	mutex        sync.RWMutex
+	config       *config.Config
+	itemFlights  *flightGroup[int, *Item]
+	memoryCache  *utils.LRU[int, *CachedItem] // the hot items, saves reading and decoding them from badger
+	freshness    FreshnessPolicy
+	// if set, the stale items are returned at once and refetched in the background
+	staleWhileRevalidate bool
+	revalidating         map[int]bool
+	visitMutex           sync.Mutex // serializes the updates of the visits
+	savedMutex           sync.Mutex // serializes the updates of the saved items
+	// the saved items are queued for the indexer, so that indexing never slows down the fetches
+	indexer    ItemIndexer
+	indexQueue chan *Item
+	indexMutex sync.RWMutex // held to send to indexQueue, it is closed under the write lock
+	indexing   sync.WaitGroup
+	// set to serve only the cache, offlineUntil is set when the network fails
+	offline      bool
+	offlineUntil time.Time
+	// cancelled on close, stops the background refetches
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+}
+
+/*
+NewRepository returns a repository caching in the badger database at cfg.DbPath,
+see OpenBadgerStore for the errors
+*/
+func NewRepository(apiClient *ApiClient, cfg *config.Config) (*Repository, error) {
+	store, err := OpenBadgerStore(cfg.DbPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return NewRepositoryWithStore(apiClient, cfg, store), nil
+}
+
+// NewRepositoryWithStore returns a repository caching in the store, the store is closed with the repository
+func NewRepositoryWithStore(apiClient *ApiClient, cfg *config.Config, store Store) *Repository {
 	client := apiClient
 	if client == nil {
-		client = NewApiClient(nil)
+		client = NewApiClient(nil, cfg.BaseUrl)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Repository{
+		store:        store,
+		apiClient:    client,
+		updatedIds:   make(map[int]bool, 0),
+		updatedUsers: make(map[string]bool, 0),
+		config:       cfg,
+		itemFlights:  newFlightGroup[int, *Item](),
+		memoryCache:  utils.NewLRU[int, *CachedItem](ITEM_MEMORY_CACHE_SIZE),
+		freshness:    DefaultFreshnessPolicy,
+		revalidating: make(map[int]bool),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// SetFreshnessPolicy sets when the cached items are refetched, nil keeps them forever
+func (r *Repository) SetFreshnessPolicy(policy FreshnessPolicy) {
+	r.freshness = policy
+}
+
+// FreshnessPolicy returns when the cached items are refetched, nil if they are kept forever
+func (r *Repository) FreshnessPolicy() FreshnessPolicy {
+	return r.freshness
+}
+
+/*
+SetStaleWhileRevalidate makes GetItem return the stale cached items at once and refetch
+them in the background, the listeners registered with OnItemUpdated get the refetched items
+*/
+func (r *Repository) SetStaleWhileRevalidate(enabled bool) {
+	r.staleWhileRevalidate = enabled
+}
+
+/*
+SetIndexer sets the index updated with the cached items, nil disables the indexing. The items
+are indexed in the background, the items queued for the previous indexer are indexed first.
+*/
+func (r *Repository) SetIndexer(indexer ItemIndexer) {
+	r.stopIndexer()
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+	r.indexer = indexer
+	if indexer == nil {
+		return
+	}
+	queue := make(chan *Item, INDEX_QUEUE_SIZE)
+	r.indexQueue = queue
+	r.indexing.Go(func() {
+		runIndexer(indexer, queue)
+	})
+}
+
+// FlushIndex waits until the queued items are indexed
+func (r *Repository) FlushIndex() {
+	r.indexMutex.RLock()
+	indexer := r.indexer
+	r.indexMutex.RUnlock()
+	r.SetIndexer(indexer)
+}
+
+// stops the indexer once it has indexed the queued items
+func (r *Repository) stopIndexer() {
+	r.indexMutex.Lock()
+	if r.indexQueue != nil {
+		close(r.indexQueue)
+		r.indexQueue = nil
 	}
-	return &Repository{db, client, make(map[int]bool, 0), &sync.WaitGroup{}, cfg}
+	r.indexMutex.Unlock()
+	r.indexing.Wait()
 }
 
+// indexes the queued items in batches until the queue is closed
+func runIndexer(indexer ItemIndexer, queue chan *Item) {
+	for item := range queue {
+		batch := []*Item{item}
+	collect:
+		for len(batch) < INDEX_BATCH_SIZE {
+			select {
+			case item, ok := <-queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, item)
+			default:
+				break collect
+			}
+		}
+		if err := indexer.IndexItems(batch); err != nil {
+			log.Printf("error while indexing %d items: %v", len(batch), err)
+		}
+	}
+}
+
+/*
+RunInBackground runs the task in a goroutine, ctx is cancelled when the repository is closed
+and Close waits for the task to return
+*/
+func (r *Repository) RunInBackground(task func(ctx context.Context)) {
+	r.background.Go(func() {
+		task(r.ctx)
+	})
+}
+
+// Store returns the store the repository caches in
+func (r *Repository) Store() Store {
+	return r.store
+}
+
+func (r *Repository) isFresh(cached *CachedItem) bool {
+	return r.freshness == nil || r.freshness.IsFresh(cached, time.Now())
+}
+
+/*
+SetUpdatedIds marks the cached items as changed, they are refetched from the API on their next get.
+The items that are not cached are fetched anyway, they are not marked so that the marks do not
+pile up with the updates of the items that are never viewed.
+*/
 func (r *Repository) SetUpdatedIds(ids []int) {
+	cached := make([]int, 0, len(ids))
 	for _, id := range ids {
+		if r.isItemCached(id) {
+			cached = append(cached, id)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, id := range cached {
 		r.updatedIds[id] = true
 	}
 }
 
-func (r *Repository) GetItem(id int) (*Item, error) {
-	var item *Item
-	if !r.updatedIds[id] {
+// SetUpdatedUsers marks the cached user profiles as changed, they are refetched from the API on their next get
+func (r *Repository) SetUpdatedUsers(ids []string) {
+	cached := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := r.store.Get(userKey(id)); err == nil {
+			cached = append(cached, id)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, id := range cached {
+		r.updatedUsers[id] = true
+	}
+}
+
+func (r *Repository) isItemCached(id int) bool {
+	if _, ok := r.memoryCache.Get(id); ok {
+		return true
+	}
+	_, err := r.store.Get(itemKey(id))
+	return err == nil
+}
+
+func (r *Repository) IsUpdated(id int) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.updatedIds[id]
+}
+
+func (r *Repository) isUserUpdated(id string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.updatedUsers[id]
+}
+
+// OnItemUpdated registers a listener called (on the fetching goroutine) whenever an updated item is refetched
+func (r *Repository) OnItemUpdated(listener ItemListener) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.listeners = append(r.listeners, listener)
+}
+
+// clears the updated mark of the refetched item and notifies the listeners if it was marked or notify is set
+func (r *Repository) itemRefetched(item *Item, notify bool) {
+	r.mutex.Lock()
+	wasUpdated := r.updatedIds[item.Id]
+	delete(r.updatedIds, item.Id)
+	listeners := r.listeners
+	r.mutex.Unlock()
+	if wasUpdated || notify {
+		for _, listener := range listeners {
+			listener(item)
+		}
+	}
+}
+
+/*
+GetItem returns the item from the memory cache, badger or the API in this order,
+the cached items are refetched when they are not fresh anymore unless offline.
+The concurrent gets of the same item share one load.
+*/
+func (r *Repository) GetItem(ctx context.Context, id int) (*Item, error) {
+	offline := r.IsOffline()
+	if !r.IsUpdated(id) || offline {
+		if cached, ok := r.memoryCache.Get(id); ok && (offline || r.isFresh(cached)) {
+			return cached.Item, nil
+		}
+	}
+	return r.itemFlights.Do(ctx, id, func(ctx context.Context) (*Item, error) {
+		return r.loadItem(ctx, id)
+	})
+}
+
+func (r *Repository) loadItem(ctx context.Context, id int) (*Item, error) {
+	var cached *CachedItem
+	offline := r.IsOffline()
+	if !r.IsUpdated(id) || offline {
 		var err error
-		item, err = r.LoadItemFromCache(id)
-		if err != nil && err != badger.ErrKeyNotFound {
+		cached, err = r.LoadItemFromCache(id)
+		if err != nil && err != ErrNotCached {
 			log.Printf("error while getting item from the repository: %v", err)
 			return nil, err
 		}
 	}
-	if item == nil {
-		apiBytes, apiError := r.apiClient.GetItem(id)
-		if apiError != nil {
-			log.Printf("error while getting item from the hacker-news API: %v", apiError)
-			return nil, apiError
+	if offline {
+		if cached == nil {
+			return nil, fmt.Errorf("item %d: %w", id, ErrNotCached)
 		}
-		jsonError := json.Unmarshal(apiBytes, &item)
-		if jsonError != nil {
-			return nil, jsonError
+		r.memoryCache.Add(id, cached)
+		return cached.Item, nil
+	}
+	if cached != nil {
+		if r.isFresh(cached) {
+			r.memoryCache.Add(id, cached)
+			return cached.Item, nil
+		}
+		if r.staleWhileRevalidate {
+			r.memoryCache.Add(id, cached)
+			r.revalidate(id)
+			return cached.Item, nil
 		}
+	}
+	item, err := r.fetchItem(ctx, id, false)
+	if err != nil {
+		if cached != nil && ctx.Err() == nil { // the stale copy is still better than nothing
+			log.Printf("serving stale item %d: %v", id, err)
+			return cached.Item, nil
+		}
+		return nil, err
+	}
+	return item, nil
+}
 
-		r.SaveItemToCache(id, item)
+// fetches the item from the API and caches it
+func (r *Repository) fetchItem(ctx context.Context, id int, notify bool) (*Item, error) {
+	var item *Item
+	apiBytes, apiError := r.apiClient.GetItem(ctx, id)
+	if apiError != nil {
+		log.Printf("error while getting item from the hacker-news API: %v", apiError)
+		r.detectOffline(ctx, apiError)
+		return nil, apiError
+	}
+	jsonError := json.Unmarshal(apiBytes, &item)
+	if jsonError != nil {
+		return nil, jsonError
+	}
+	if item == nil { // the API responds with null for unknown items
+		return nil, fmt.Errorf("item %d: %w", id, ErrNotFound)
 	}
+
+	cached := &CachedItem{item, time.Now().Unix()}
+	r.saveCachedItem(cached)
+	r.memoryCache.Add(id, cached)
+	r.itemRefetched(item, notify)
 	return item, nil
 }
 
-func (r *Repository) GetItems(ids []int) ([]*Item, error) {
+// refetches the item in the background unless it is already being refetched
+func (r *Repository) revalidate(id int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.revalidating[id] || r.ctx.Err() != nil {
+		return
+	}
+	r.revalidating[id] = true
+	r.background.Go(func() {
+		if _, err := r.fetchItem(r.ctx, id, true); err != nil && r.ctx.Err() == nil {
+			log.Printf("error while revalidating item %d: %v", id, err)
+		}
+		r.mutex.Lock()
+		delete(r.revalidating, id)
+		r.mutex.Unlock()
+	})
+}
+
+/*
+ItemResult is the outcome of fetching the item at Index of the requested ids
+*/
+type ItemResult struct {
+	Index int
+	Id    int
+	Item  *Item
+	Err   error
+}
+
+/*
+GetItems returns the items in the order of ids. The items that could not be fetched
+are nil and their errors are returned joined as *ItemError values.
+When ctx is done only the error of the context is returned.
+*/
+func (r *Repository) GetItems(ctx context.Context, ids []int) ([]*Item, error) {
 	items := make([]*Item, len(ids))
-	processedCount := 0
-	for processedCount < len(ids) {
-		for i := processedCount; i < min(processedCount+MAX_ITEM_GET_BATCH_SIZE, len(ids)); i++ {
-			r.wg.Go(func() {
-				item, err := r.GetItem(ids[i])
-				if err != nil {
-					items[i] = nil
-				} else {
-					items[i] = item
-				}
-			})
+	errs := make([]error, 0)
+	for result := range r.StreamItems(ctx, ids) {
+		if result.Err != nil {
+			errs = append(errs, &ItemError{result.Id, result.Err})
+			continue
 		}
-		r.wg.Wait()
-		processedCount += (MAX_ITEM_GET_BATCH_SIZE - 1)
+		items[result.Index] = result.Item
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	return items, nil
+	return items, errors.Join(errs...)
 }
 
-func (r *Repository) LoadItemFromCache(id int) (*Item, error) {
-	var item Item
-	cacheError := r.db.View(func(txn *badger.Txn) error {
-		cachedBytes, err := txn.Get([]byte(strconv.Itoa(id)))
-		if err != nil {
-			return err
+/*
+StreamItems fetches the items with a pool of at most MAX_ITEM_GET_WORKERS workers and
+yields the results in the order of ids as soon as they are ready, so the items can be
+shown progressively. Duplicate ids are fetched only once. The workers are stopped when
+the loop is broken or ctx is done.
+*/
+func (r *Repository) StreamItems(ctx context.Context, ids []int) iter.Seq[ItemResult] {
+	return func(yield func(ItemResult) bool) {
+		uniqueIds := make([]int, 0, len(ids))
+		seen := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				uniqueIds = append(uniqueIds, id)
+			}
+		}
+		if len(uniqueIds) == 0 {
+			return
 		}
-		extractValueError := cachedBytes.Value(func(val []byte) error {
-			jsonError := json.Unmarshal(val, &item)
-			if jsonError != nil {
-				return jsonError
+
+		ctx, cancel := context.WithCancel(ctx)
+		jobs := make(chan int)
+		results := make(chan ItemResult)
+		wg := sync.WaitGroup{}
+		defer func() {
+			cancel()
+			wg.Wait()
+		}()
+		wg.Go(func() {
+			defer close(jobs)
+			for _, id := range uniqueIds {
+				select {
+				case jobs <- id:
+				case <-ctx.Done():
+					return
+				}
 			}
-			return nil
 		})
-		if extractValueError != nil {
-			return extractValueError
+		for range min(MAX_ITEM_GET_WORKERS, len(uniqueIds)) {
+			wg.Go(func() {
+				for id := range jobs {
+					item, err := r.GetItem(ctx, id)
+					select {
+					case results <- ItemResult{Id: id, Item: item, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			})
+		}
+
+		// the results are buffered until the ones before them in ids are yielded
+		fetched := make(map[int]ItemResult, len(uniqueIds))
+		next := 0
+		for next < len(ids) {
+			select {
+			case result := <-results:
+				fetched[result.Id] = result
+			case <-ctx.Done():
+				return
+			}
+			for next < len(ids) {
+				result, ok := fetched[ids[next]]
+				if !ok {
+					break
+				}
+				result.Index = next
+				if !yield(result) {
+					return
+				}
+				next++
+			}
 		}
-		return nil
-	})
-	if cacheError != nil {
-		return nil, cacheError
 	}
-	return &item, nil
 }
 
+// LoadItemFromCache returns the cached item with the time it was fetched at
+func (r *Repository) LoadItemFromCache(id int) (*CachedItem, error) {
+	return r.store.LoadItem(id)
+}
+
+// SaveItemToCache stores the item as fetched now
 func (r *Repository) SaveItemToCache(id int, item *Item) error {
-	err := r.db.Update(func(txn *badger.Txn) error {
-		bytes, err := json.Marshal(item)
-		if err != nil {
-			return err
+	return r.saveCachedItem(&CachedItem{item, time.Now().Unix()})
+}
+
+func (r *Repository) saveCachedItem(cached *CachedItem) error {
+	if err := r.store.SaveItem(cached); err != nil {
+		return err
+	}
+	r.indexItem(cached.Item)
+	return nil
+}
+
+// queues the item for the indexer, the deleted items are removed from the index
+func (r *Repository) indexItem(item *Item) {
+	r.indexMutex.RLock()
+	defer r.indexMutex.RUnlock()
+	if r.indexQueue != nil {
+		r.indexQueue <- item
+	}
+}
+
+func (r *Repository) GetUser(ctx context.Context, id string) (*User, error) {
+	var user *User
+	offline := r.IsOffline()
+	if !r.isUserUpdated(id) || offline {
+		var err error
+		user, err = r.LoadUserFromCache(id)
+		if err != nil && err != ErrNotCached {
+			log.Printf("error while getting user from the repository: %v", err)
+			return nil, err
 		}
-		err = txn.Set([]byte(strconv.Itoa(id)), bytes)
-		if err != nil {
-			return err
+	}
+	if user == nil && offline {
+		return nil, fmt.Errorf("user \"%s\": %w", id, ErrNotCached)
+	}
+	if user == nil {
+		apiBytes, apiError := r.apiClient.GetUser(ctx, id)
+		if apiError != nil {
+			log.Printf("error while getting user from the hacker-news API: %v", apiError)
+			if r.detectOffline(ctx, apiError) {
+				if cached, err := r.LoadUserFromCache(id); err == nil { // the updated profile is better than nothing
+					return cached, nil
+				}
+			}
+			return nil, apiError
 		}
-		return nil
-	})
-	return err
+		jsonError := json.Unmarshal(apiBytes, &user)
+		if jsonError != nil {
+			return nil, jsonError
+		}
+		if user == nil { // the API responds with null for unknown users
+			return nil, fmt.Errorf("user \"%s\": %w", id, ErrNotFound)
+		}
+
+		r.SaveUserToCache(user)
+		r.mutex.Lock()
+		delete(r.updatedUsers, id)
+		r.mutex.Unlock()
+	}
+	return user, nil
+}
+
+func (r *Repository) LoadUserFromCache(id string) (*User, error) {
+	return r.store.LoadUser(id)
+}
+
+func (r *Repository) SaveUserToCache(user *User) error {
+	return r.store.SaveUser(user)
+}
+
+// GetFeedIds returns the ids of the feed, see GetFeed
+func (r *Repository) GetFeedIds(ctx context.Context, feed Feed) ([]int, error) {
+	cached, err := r.GetFeed(ctx, feed)
+	if err != nil {
+		return nil, err
+	}
+	return cached.Ids, nil
 }
 
 func (r *Repository) Close() {
-	r.db.Close()
+	r.cancel()
+	r.background.Wait()
+	r.stopIndexer()
+	if err := r.store.Close(); err != nil {
+		log.Printf("error while closing the store: %v", err)
+	}
 }
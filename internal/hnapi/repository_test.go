@@ -0,0 +1,388 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestRepository(t *testing.T, server *hntest.Server) *hnapi.Repository {
+	api := hnapi.NewApiClient(nil, server.BaseUrl())
+	api.SetRetryPolicy(hnapi.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond * 5})
+	repo, err := hnapi.NewRepository(api, &config.Config{DbPath: t.TempDir(), BaseUrl: server.BaseUrl()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func Test_Repository_GetItemIsCached(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	for range 2 {
+		item, err := repo.GetItem(context.Background(), 100)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if item.Title != "Show HN: A terminal reader for Hacker News" {
+			t.Errorf("Unexpected title \"%s\"", item.Title)
+		}
+	}
+	if count := server.RequestCount("item/100.json"); count != 1 {
+		t.Errorf("Expected 1 request for the item, got %d", count)
+	}
+}
+
+func Test_Repository_GetItemNotFound(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	if _, err := repo.GetItem(context.Background(), 12345); !errors.Is(err, hnapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func Test_Repository_GetItemRetriesServerErrors(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	server.FailNext("item/200.json", http.StatusInternalServerError, http.StatusServiceUnavailable)
+	repo := newTestRepository(t, server)
+	item, err := repo.GetItem(context.Background(), 200)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if item.Id != 200 || server.RequestCount("item/200.json") != 3 {
+		t.Errorf("Expected item 200 after 3 requests, got %d after %d", item.Id, server.RequestCount("item/200.json"))
+	}
+}
+
+func Test_Repository_GetItemsKeepsOrder(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	ids, err := hnapi.NewApiClient(nil, server.BaseUrl()).GetFeedIds(context.Background(), hnapi.FeedNew)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	items, err := repo.GetItems(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i, id := range []int{300, 200, 100} {
+		if items[i] == nil || items[i].Id != id {
+			t.Errorf("Expected item %d at index %d, got %v", id, i, items[i])
+		}
+	}
+}
+
+func Test_Repository_GetItemsCancelled(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	server.SetLatency(time.Second * 5)
+	repo := newTestRepository(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	if _, err := repo.GetItems(ctx, []int{100, 200, 300}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the cancellation to abort the requests, took %v", elapsed)
+	}
+}
+
+func Test_Repository_GetUser(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	user, err := repo.GetUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Karma != 4321 || len(user.Submitted) != 2 {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if _, err := repo.GetUser(context.Background(), "nobody"); !errors.Is(err, hnapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func Test_Repository_GetCommentTree(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	tree, err := repo.GetCommentTree(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Item.Id != 101 || tree.Children[1].Item.Id != 102 {
+		t.Fatalf("Unexpected top level comments %+v", tree.Children)
+	}
+	replies := tree.Children[0].Children
+	if len(replies) != 2 || replies[0].Item.Id != 103 || replies[0].Depth != 2 {
+		t.Errorf("Unexpected replies %+v", replies)
+	}
+	if !tree.Children[1].IsRemoved() || !replies[1].IsRemoved() {
+		t.Errorf("Expected the deleted and the dead comments to be removed")
+	}
+
+	shallowTree, err := repo.GetCommentTree(context.Background(), 100, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(shallowTree.Children) != 2 || len(shallowTree.Children[0].Children) != 0 {
+		t.Errorf("Expected only the top level comments with depth 1")
+	}
+}
+
+func Test_Repository_GetItemsDeduplicatesIds(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	items, err := repo.GetItems(context.Background(), []int{100, 200, 100, 100})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(items) != 4 || items[0].Id != 100 || items[1].Id != 200 || items[3].Id != 100 {
+		t.Errorf("Expected the items in the order of the ids, got %v", items)
+	}
+	if count := server.RequestCount("item/100.json"); count != 1 {
+		t.Errorf("Expected 1 request for the duplicate id, got %d", count)
+	}
+}
+
+func Test_Repository_GetItemsReturnsItemErrors(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	items, err := repo.GetItems(context.Background(), []int{100, 999, 200})
+	if items == nil || items[0] == nil || items[1] != nil || items[2] == nil {
+		t.Fatalf("Expected only the missing item to be nil, got %v", items)
+	}
+	var itemError *hnapi.ItemError
+	if !errors.As(err, &itemError) || itemError.Id != 999 || !errors.Is(err, hnapi.ErrNotFound) {
+		t.Errorf("Expected an ItemError of item 999 with ErrNotFound, got %v", err)
+	}
+}
+
+func Test_Repository_StreamItems(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	ids := []int{300, 100, 400, 200, 101, 103}
+	indexes := make([]int, 0)
+	for result := range repo.StreamItems(context.Background(), ids) {
+		if result.Err != nil || result.Item.Id != ids[result.Index] {
+			t.Errorf("Unexpected result %+v", result)
+		}
+		indexes = append(indexes, result.Index)
+	}
+	if len(indexes) != len(ids) {
+		t.Fatalf("Expected %d results, got %d", len(ids), len(indexes))
+	}
+	for i, index := range indexes {
+		if i != index {
+			t.Errorf("Expected the results in order, got %v", indexes)
+			break
+		}
+	}
+
+	count := 0
+	for range repo.StreamItems(context.Background(), ids) {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("Expected the loop to stop after the break")
+	}
+}
+
+func Test_Repository_GetItemSharesConcurrentFetches(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	server.SetLatency(time.Millisecond * 50)
+	repo := newTestRepository(t, server)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 5)
+	for i := range 5 {
+		ctx := context.Background()
+		if i == 0 { // the caller starting the fetch gives up, the others still get the item
+			ctx = cancelledCtx
+		}
+		go func() {
+			item, err := repo.GetItem(ctx, 100)
+			if err == nil && item.Id != 100 {
+				err = errors.New("unexpected item")
+			}
+			results <- err
+		}()
+	}
+	time.Sleep(time.Millisecond * 10)
+	cancel()
+	failed := 0
+	for range 5 {
+		if err := <-results; err != nil {
+			failed++
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}
+	}
+	if failed > 1 {
+		t.Errorf("Expected only the cancelled get to fail, %d failed", failed)
+	}
+	if count := server.RequestCount("item/100.json"); count != 1 {
+		t.Errorf("Expected the concurrent gets to share 1 request, got %d", count)
+	}
+}
+
+// every cached item is stale under this policy
+var alwaysStale = hnapi.FreshnessPolicy{{MaxItemAge: time.Duration(1 << 62), TTL: 0}}
+
+func Test_Repository_GetItemRefetchesStaleItems(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.SetFreshnessPolicy(alwaysStale)
+	for range 2 {
+		if _, err := repo.GetItem(context.Background(), 100); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if count := server.RequestCount("item/100.json"); count != 2 {
+		t.Errorf("Expected 2 requests for the stale item, got %d", count)
+	}
+
+	// the stale copy is served when the API is down
+	server.FailNext("item/100.json", http.StatusNotFound)
+	item, err := repo.GetItem(context.Background(), 100)
+	if err != nil || item.Id != 100 {
+		t.Errorf("Expected the stale item 100, got %v, %v", item, err)
+	}
+}
+
+func Test_Repository_StaleWhileRevalidate(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	if _, err := repo.GetItem(context.Background(), 200); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.SetFreshnessPolicy(alwaysStale)
+	repo.SetStaleWhileRevalidate(true)
+	revalidated := make(chan *hnapi.Item, 1)
+	repo.OnItemUpdated(func(item *hnapi.Item) {
+		revalidated <- item
+	})
+
+	updated, _ := server.Item(200)
+	updated.Score = 500
+	server.AddItems(updated)
+	item, err := repo.GetItem(context.Background(), 200)
+	if err != nil || item.Score != 300 {
+		t.Fatalf("Expected the stale item with score 300 at once, got %v, %v", item, err)
+	}
+	select {
+	case item := <-revalidated:
+		if item.Score != 500 {
+			t.Errorf("Expected the revalidated score 500, got %d", item.Score)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Expected the listener to get the revalidated item")
+	}
+}
+
+func Test_Repository_Offline(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	if _, err := repo.GetFeedIds(context.Background(), hnapi.FeedTop); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetCommentTree(context.Background(), 100, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.SetFreshnessPolicy(alwaysStale)
+	repo.SetOffline(true)
+	requests := server.RequestCount("item/100.json")
+
+	feed, err := repo.GetFeed(context.Background(), hnapi.FeedTop)
+	if err != nil || len(feed.Ids) != 3 || feed.FetchedAt == 0 {
+		t.Errorf("Expected the snapshot of the feed, got %v, %v", feed, err)
+	}
+	if _, err := repo.GetFeed(context.Background(), hnapi.FeedNew); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected ErrNotCached for a feed never fetched, got %v", err)
+	}
+	tree, err := repo.GetCommentTree(context.Background(), 100, 1)
+	if err != nil || len(tree.Children) != 2 {
+		t.Errorf("Expected the cached comments, got %v, %v", tree, err)
+	}
+	if _, err := repo.GetItem(context.Background(), 200); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected ErrNotCached for an item never fetched, got %v", err)
+	}
+	if count := server.RequestCount("item/100.json"); count != requests {
+		t.Errorf("Expected no requests offline, got %d", count-requests)
+	}
+}
+
+func Test_Repository_DetectsOffline(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	repo := newTestRepository(t, server)
+	if _, err := repo.GetFeedIds(context.Background(), hnapi.FeedTop); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	server.Close()
+	ids, err := repo.GetFeedIds(context.Background(), hnapi.FeedTop)
+	if err != nil || len(ids) != 3 {
+		t.Errorf("Expected the snapshot of the feed, got %v, %v", ids, err)
+	}
+	if !repo.IsOffline() {
+		t.Errorf("Expected the repository to be offline")
+	}
+}
+
+func Test_Repository_Sync(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	options := hnapi.SyncOptions{Feeds: []hnapi.Feed{hnapi.FeedTop}, StoryCount: 2, Concurrency: 1}
+
+	// interrupted after the first story
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := repo.Sync(ctx, options, func(progress hnapi.SyncProgress) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the sync to be cancelled, got %v", err)
+	}
+
+	report, err := repo.Sync(context.Background(), options, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Resumed != 1 || report.Stories != 1 {
+		t.Errorf("Expected 1 resumed and 1 synced story, got %d and %d", report.Resumed, report.Stories)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if _, err := repo.LoadUserFromCache(user); err != nil {
+			t.Errorf("Expected the profile of %s to be synced, got %v", user, err)
+		}
+	}
+
+	repo.SetOffline(true)
+	tree, err := repo.GetCommentTree(context.Background(), 100, 0)
+	if err != nil || len(tree.Children) != 2 || len(tree.Children[0].Children) != 2 {
+		t.Errorf("Expected the synced comment tree, got %v, %v", tree, err)
+	}
+	if _, err := repo.Sync(context.Background(), options, nil); !errors.Is(err, hnapi.ErrOfflineSync) {
+		t.Errorf("Expected ErrOfflineSync, got %v", err)
+	}
+}
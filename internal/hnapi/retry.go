@@ -0,0 +1,152 @@
+package hnapi
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_BREAKER_THRESHOLD = 5
+	DEFAULT_BREAKER_COOLDOWN  = time.Second * 30
+)
+
+/*
+RetryPolicy describes how many times and how long apart the failed requests are retried.
+The delay doubles with every attempt starting from BaseDelay up to MaxDelay, then
+a random part of it (Jitter, between 0 and 1) is subtracted so the clients don't retry in sync.
+*/
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond * 200,
+	MaxDelay:    time.Second * 5,
+	Jitter:      0.5,
+}
+
+// NoRetryPolicy sends every request only once
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// Delay returns how long to wait before the given (1 based) retry attempt
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if p.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// retryAfter returns the delay requested by the server in the Retry-After header if any
+func retryAfter(response *http.Response) time.Duration {
+	if response == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// sleep waits for the duration or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isNetworkError(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+/*
+CircuitBreaker stops sending requests after threshold consecutive failures,
+after every cooldown it lets one request through and closes again if that succeeds
+*/
+type CircuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	state     breakerState
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DEFAULT_BREAKER_THRESHOLD
+	}
+	if cooldown <= 0 {
+		cooldown = DEFAULT_BREAKER_COOLDOWN
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow returns ErrCircuitOpen if the request should not be sent
+func (b *CircuitBreaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == breakerClosed {
+		return nil
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	// let a trial request through, the next one is allowed only after another cooldown
+	b.state = breakerHalfOpen
+	b.openedAt = time.Now()
+	return nil
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.state = breakerClosed
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// IsOpen returns true while the requests are rejected
+func (b *CircuitBreaker) IsOpen() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state != breakerClosed && time.Since(b.openedAt) < b.cooldown
+}
@@ -0,0 +1,111 @@
+package hnapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// returns an api client whose responses are served by the statuses in order
+func newStubApiClient(statuses ...int) (*ApiClient, *int) {
+	requestCount := 0
+	client := &http.Client{Transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		status := statuses[min(requestCount, len(statuses)-1)]
+		requestCount++
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("[1,2,3]")),
+			Request:    request,
+		}, nil
+	})}
+	api := NewApiClient(client, "")
+	api.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond * 5})
+	return api, &requestCount
+}
+
+func Test_RetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond * 100, MaxDelay: time.Millisecond * 300}
+	expected := []time.Duration{time.Millisecond * 100, time.Millisecond * 200, time.Millisecond * 300, time.Millisecond * 300}
+	for i, e := range expected {
+		if actual := policy.Delay(i + 1); actual != e {
+			t.Errorf("Expected delay %v for attempt %d, got %v", e, i+1, actual)
+		}
+	}
+	policy.Jitter = 0.5
+	for range 100 {
+		if actual := policy.Delay(2); actual < time.Millisecond*100 || actual > time.Millisecond*200 {
+			t.Errorf("Expected the jittered delay to be between 100ms and 200ms, got %v", actual)
+		}
+	}
+}
+
+func Test_ApiClient_RetriesTemporaryErrors(t *testing.T) {
+	api, requestCount := newStubApiClient(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	ids, err := api.GetFeedIds(context.Background(), FeedTop)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ids) != 3 || *requestCount != 3 {
+		t.Errorf("Expected 3 ids after 3 requests, got %d ids after %d requests", len(ids), *requestCount)
+	}
+}
+
+func Test_ApiClient_DoesNotRetryClientErrors(t *testing.T) {
+	api, requestCount := newStubApiClient(http.StatusNotFound, http.StatusOK)
+	_, err := api.GetFeedIds(context.Background(), FeedTop)
+	var statusError *StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a StatusError with 404, got %v", err)
+	}
+	if *requestCount != 1 {
+		t.Errorf("Expected 1 request, got %d", *requestCount)
+	}
+}
+
+func Test_ApiClient_CircuitBreakerFailsFast(t *testing.T) {
+	api, requestCount := newStubApiClient(http.StatusBadGateway)
+	api.SetRetryPolicy(NoRetryPolicy)
+	api.SetCircuitBreaker(NewCircuitBreaker(2, time.Hour))
+	for range 2 {
+		if _, err := api.GetItem(context.Background(), 1); err == nil {
+			t.Fatalf("Expected an error")
+		}
+	}
+	_, err := api.GetItem(context.Background(), 1)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if *requestCount != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requestCount)
+	}
+}
+
+func Test_CircuitBreaker_HalfOpen(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Millisecond*10)
+	breaker.Failure()
+	if breaker.Allow() == nil {
+		t.Errorf("Expected the breaker to be open")
+	}
+	time.Sleep(time.Millisecond * 15)
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Expected a trial request to be allowed, got %v", err)
+	}
+	if breaker.Allow() == nil {
+		t.Errorf("Expected only one trial request to be allowed")
+	}
+	breaker.Success()
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Expected the breaker to be closed, got %v", err)
+	}
+}
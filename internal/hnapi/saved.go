@@ -0,0 +1,119 @@
+package hnapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNotSaved is returned when unsaving an item that is not saved
+var ErrNotSaved = errors.New("not saved")
+
+/*
+SavedItem is a story or comment saved to read later, with the tags and the note of the user
+*/
+type SavedItem struct {
+	Id      int      `json:"id"`
+	SavedAt int64    `json:"saved_at"` // unix time
+	Tags    []string `json:"tags"`
+	Note    string   `json:"note"`
+}
+
+func (s *SavedItem) SavedTime() time.Time {
+	return time.Unix(s.SavedAt, 0)
+}
+
+// HasTags returns true if the item is tagged with all the tags
+func (s *SavedItem) HasTags(tags []string) bool {
+	for _, tag := range normalizeTags(tags) {
+		if !slices.Contains(s.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// the tags are lower case without the surrounding spaces, sorted and unique
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+/*
+Save saves the item, fetching it if it is not cached yet. Saving a saved item again adds
+the tags to its tags and replaces its note if note is not empty.
+*/
+func (r *Repository) Save(ctx context.Context, id int, tags []string, note string) (*SavedItem, error) {
+	if _, err := r.GetItem(ctx, id); err != nil {
+		return nil, err
+	}
+	r.savedMutex.Lock()
+	defer r.savedMutex.Unlock()
+	saved, err := r.LoadSaved(id)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		saved = &SavedItem{Id: id, SavedAt: time.Now().Unix()}
+	}
+	saved.Tags = normalizeTags(append(saved.Tags, tags...))
+	if note != "" {
+		saved.Note = note
+	}
+	return saved, r.store.SaveSaved(saved)
+}
+
+// Unsave removes the item from the saved items, the item stays in the cache
+func (r *Repository) Unsave(id int) error {
+	r.savedMutex.Lock()
+	defer r.savedMutex.Unlock()
+	saved, err := r.LoadSaved(id)
+	if err != nil {
+		return err
+	}
+	if saved == nil {
+		return fmt.Errorf("item %d: %w", id, ErrNotSaved)
+	}
+	return r.store.DeleteSaved(id)
+}
+
+// LoadSaved returns the saved item, nil if the item is not saved
+func (r *Repository) LoadSaved(id int) (*SavedItem, error) {
+	saved, err := r.store.LoadSaved(id)
+	if errors.Is(err, ErrNotCached) {
+		return nil, nil
+	}
+	return saved, err
+}
+
+/*
+SavedItems returns the saved items tagged with all the tags, the last saved first
+*/
+func (r *Repository) SavedItems(tags ...string) ([]*SavedItem, error) {
+	savedItems := make([]*SavedItem, 0)
+	err := r.store.Scan(SAVED_KEY_PREFIX, func(key string, value []byte) error {
+		var saved SavedItem
+		if err := json.Unmarshal(value, &saved); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if saved.HasTags(tags) {
+			savedItems = append(savedItems, &saved)
+		}
+		return nil
+	})
+	slices.SortStableFunc(savedItems, func(a, b *SavedItem) int {
+		return int(b.SavedAt - a.SavedAt)
+	})
+	return savedItems, err
+}
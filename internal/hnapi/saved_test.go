@@ -0,0 +1,61 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"slices"
+	"testing"
+)
+
+func Test_Repository_SaveAndUnsave(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	ctx := context.Background()
+	if _, err := repo.Save(ctx, 100, []string{"Go", "tools "}, "read tonight"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	saved, err := repo.Save(ctx, 100, []string{"go", "terminal"}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !slices.Equal(saved.Tags, []string{"go", "terminal", "tools"}) || saved.Note != "read tonight" {
+		t.Errorf("Expected the merged tags and the note to be kept, got %v and \"%s\"", saved.Tags, saved.Note)
+	}
+	repo.Save(ctx, 200, []string{"go"}, "")
+	if _, err := repo.Save(ctx, 12345, nil, ""); !errors.Is(err, hnapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown item, got %v", err)
+	}
+
+	tagged, err := repo.SavedItems("go")
+	if err != nil || len(tagged) != 2 {
+		t.Errorf("Expected the 2 items tagged go, got %v, %v", tagged, err)
+	}
+	tagged, _ = repo.SavedItems("go", "terminal")
+	if len(tagged) != 1 || tagged[0].Id != 100 {
+		t.Errorf("Expected only item 100 to have both tags, got %v", tagged)
+	}
+
+	// the saved stories and their comments are kept by the gc
+	repo.GetCommentTree(ctx, 100, 0)
+	repo.GetItem(ctx, 300)
+	report, err := repo.GC(hnapi.GCOptions{Unlinked: true})
+	if err != nil || report.Removed != 1 {
+		t.Errorf("Expected only the unsaved item 300 to be removed, got %v, %v", report, err)
+	}
+	if _, err := repo.LoadItemFromCache(104); err != nil {
+		t.Errorf("Expected the comments of the saved story to be kept, got %v", err)
+	}
+
+	if err := repo.Unsave(100); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := repo.Unsave(100); !errors.Is(err, hnapi.ErrNotSaved) {
+		t.Errorf("Expected ErrNotSaved, got %v", err)
+	}
+	if saved, _ := repo.LoadSaved(100); saved != nil {
+		t.Errorf("Expected the item to be unsaved, got %v", saved)
+	}
+}
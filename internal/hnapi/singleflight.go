@@ -0,0 +1,72 @@
+package hnapi
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+flightGroup collapses the concurrent calls with the same key into one call whose
+result is shared by all the callers. The shared call is cancelled only when all of
+its callers gave up waiting for it.
+*/
+type flightGroup[K comparable, V any] struct {
+	mutex sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+type flightCall[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newFlightGroup[K comparable, V any]() *flightGroup[K, V] {
+	return &flightGroup[K, V]{calls: make(map[K]*flightCall[V])}
+}
+
+func (g *flightGroup[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (V, error) {
+	g.mutex.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		// the call must outlive the ctx of the caller starting it as others may wait for it
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &flightCall[V]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go func() {
+			call.value, call.err = fn(callCtx)
+			cancel()
+			g.forget(key, call)
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		g.mutex.Lock()
+		call.waiters--
+		if call.waiters == 0 { // nobody waits for the result anymore
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mutex.Unlock()
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (g *flightGroup[K, V]) forget(key K, call *flightCall[V]) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,222 @@
+package hnapi
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const ITEM_KEY_PREFIX = "item/"
+const USER_KEY_PREFIX = "user/"
+const FEED_KEY_PREFIX = "feed/"
+const META_KEY_PREFIX = "meta/"
+const VISIT_KEY_PREFIX = "visit/"
+const SAVED_KEY_PREFIX = "saved/"
+
+// ErrNotCached is returned by the stores for the records they do not have
+var ErrNotCached = errors.New("not cached")
+
+// ErrStoreReadOnly is returned when writing to a store opened read-only
+var ErrStoreReadOnly = errors.New("the store is read-only")
+
+// ErrStoreLocked is returned when the database is used by another process and can not be opened even read-only
+var ErrStoreLocked = errors.New("the database is locked by another process")
+
+/*
+CachedFeed is a snapshot of the ids of a feed along with the time it was fetched at
+*/
+type CachedFeed struct {
+	Ids       []int `json:"ids"`
+	FetchedAt int64 `json:"fetched_at"` // unix time
+}
+
+func (c *CachedFeed) FetchedTime() time.Time {
+	return time.Unix(c.FetchedAt, 0)
+}
+
+/*
+Store persists the records of the repository. The loads return ErrNotCached for
+the missing records and the saves of a read-only store return ErrStoreReadOnly.
+*/
+type Store interface {
+	LoadItem(id int) (*CachedItem, error)
+	SaveItem(cached *CachedItem) error
+	LoadUser(id string) (*User, error)
+	SaveUser(user *User) error
+	LoadFeed(feed Feed) (*CachedFeed, error)
+	SaveFeed(feed Feed, cached *CachedFeed) error
+	LoadMeta(key string) ([]byte, error)
+	SaveMeta(key string, value []byte) error
+	LoadVisit(storyId int) (*Visit, error)
+	SaveVisit(visit *Visit) error
+	LoadSaved(id int) (*SavedItem, error)
+	SaveSaved(saved *SavedItem) error
+	DeleteSaved(id int) error
+	// the raw records for the maintenance of the store, see the *_KEY_PREFIX constants for the keys
+	Scan(prefix string, fn func(key string, value []byte) error) error
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	// WriteBatch deletes and sets the records at once
+	WriteBatch(set map[string][]byte, deleted []string) error
+	// Size returns the bytes used by the records
+	Size() int64
+	// Compact reclaims the space of the deleted records
+	Compact() error
+	ReadOnly() bool
+	Close() error
+}
+
+func itemKey(id int) string {
+	return ITEM_KEY_PREFIX + strconv.Itoa(id)
+}
+
+func userKey(id string) string {
+	return USER_KEY_PREFIX + id
+}
+
+func feedKey(feed Feed) string {
+	return FEED_KEY_PREFIX + feed.String()
+}
+
+func metaKey(key string) string {
+	return META_KEY_PREFIX + key
+}
+
+func visitKey(storyId int) string {
+	return VISIT_KEY_PREFIX + strconv.Itoa(storyId)
+}
+
+func savedKey(id int) string {
+	return SAVED_KEY_PREFIX + strconv.Itoa(id)
+}
+
+/*
+the raw records of a store, get returns ErrNotCached for the missing keys and scan calls
+fn with the records under the prefix in the order of their keys until fn returns an error
+*/
+type keyValues interface {
+	get(key string) ([]byte, error)
+	set(key string, value []byte) error
+	delete(key string) error
+	scan(prefix string, fn func(key string, value []byte) error) error
+	writeBatch(set map[string][]byte, deleted []string) error
+}
+
+// returned by the scan callbacks to stop the scan without an error
+var errStopScan = errors.New("scan stopped")
+
+// records implements the Store methods encoding the records as json
+type records struct {
+	kv keyValues
+}
+
+func (r records) load(key string, value any) error {
+	bytes, err := r.kv.get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, value)
+}
+
+func (r records) save(key string, value any) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.kv.set(key, bytes)
+}
+
+func (r records) LoadItem(id int) (*CachedItem, error) {
+	var cached CachedItem
+	if err := r.load(itemKey(id), &cached); err != nil {
+		return nil, err
+	}
+	return &cached, nil
+}
+
+func (r records) SaveItem(cached *CachedItem) error {
+	return r.save(itemKey(cached.Item.Id), cached)
+}
+
+func (r records) LoadUser(id string) (*User, error) {
+	var user User
+	if err := r.load(userKey(id), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r records) SaveUser(user *User) error {
+	return r.save(userKey(user.Id), user)
+}
+
+func (r records) LoadFeed(feed Feed) (*CachedFeed, error) {
+	var cached CachedFeed
+	if err := r.load(feedKey(feed), &cached); err != nil {
+		return nil, err
+	}
+	return &cached, nil
+}
+
+func (r records) SaveFeed(feed Feed, cached *CachedFeed) error {
+	return r.save(feedKey(feed), cached)
+}
+
+// LoadMeta returns the raw value of a metadata record
+func (r records) LoadMeta(key string) ([]byte, error) {
+	return r.kv.get(metaKey(key))
+}
+
+func (r records) SaveMeta(key string, value []byte) error {
+	return r.kv.set(metaKey(key), value)
+}
+
+func (r records) LoadVisit(storyId int) (*Visit, error) {
+	var visit Visit
+	if err := r.load(visitKey(storyId), &visit); err != nil {
+		return nil, err
+	}
+	return &visit, nil
+}
+
+func (r records) SaveVisit(visit *Visit) error {
+	return r.save(visitKey(visit.StoryId), visit)
+}
+
+func (r records) LoadSaved(id int) (*SavedItem, error) {
+	var saved SavedItem
+	if err := r.load(savedKey(id), &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (r records) SaveSaved(saved *SavedItem) error {
+	return r.save(savedKey(saved.Id), saved)
+}
+
+func (r records) DeleteSaved(id int) error {
+	return r.kv.delete(savedKey(id))
+}
+
+func (r records) Scan(prefix string, fn func(key string, value []byte) error) error {
+	return r.kv.scan(prefix, fn)
+}
+
+func (r records) Get(key string) ([]byte, error) {
+	return r.kv.get(key)
+}
+
+func (r records) Set(key string, value []byte) error {
+	return r.kv.set(key, value)
+}
+
+func (r records) Delete(key string) error {
+	return r.kv.delete(key)
+}
+
+func (r records) WriteBatch(set map[string][]byte, deleted []string) error {
+	return r.kv.writeBatch(set, deleted)
+}
@@ -0,0 +1,101 @@
+package hnapi_test
+
+import (
+	"errors"
+	"hnterminal/internal/hnapi"
+	"testing"
+)
+
+func testStoreRecords(t *testing.T, store hnapi.Store) {
+	if _, err := store.LoadItem(1); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected ErrNotCached, got %v", err)
+	}
+	item := &hnapi.Item{Id: 1, Title: "A title"}
+	if err := store.SaveItem(&hnapi.CachedItem{Item: item, FetchedAt: 42}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cached, err := store.LoadItem(1)
+	if err != nil || cached.Item.Title != "A title" || cached.FetchedAt != 42 {
+		t.Errorf("Expected the saved item, got %v, %v", cached, err)
+	}
+
+	if err := store.SaveUser(&hnapi.User{Id: "alice", Karma: 10}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user, err := store.LoadUser("alice"); err != nil || user.Karma != 10 {
+		t.Errorf("Expected the saved user, got %v, %v", user, err)
+	}
+
+	if err := store.SaveFeed(hnapi.FeedNew, &hnapi.CachedFeed{Ids: []int{3, 2, 1}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if feed, err := store.LoadFeed(hnapi.FeedNew); err != nil || len(feed.Ids) != 3 {
+		t.Errorf("Expected the saved feed, got %v, %v", feed, err)
+	}
+	if _, err := store.LoadFeed(hnapi.FeedTop); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected ErrNotCached, got %v", err)
+	}
+
+	if err := store.SaveMeta("key", []byte("value")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, err := store.LoadMeta("key"); err != nil || string(value) != "value" {
+		t.Errorf("Expected \"value\", got \"%s\", %v", value, err)
+	}
+}
+
+func Test_MemoryStore(t *testing.T) {
+	testStoreRecords(t, hnapi.NewMemoryStore())
+}
+
+func Test_BadgerStore(t *testing.T) {
+	store, err := hnapi.OpenBadgerStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer store.Close()
+	testStoreRecords(t, store)
+}
+
+func Test_BadgerStoreLocked(t *testing.T) {
+	path := t.TempDir()
+	store, err := hnapi.OpenBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer store.Close()
+	if _, err := hnapi.OpenBadgerStore(path); !errors.Is(err, hnapi.ErrStoreLocked) {
+		t.Errorf("Expected ErrStoreLocked, got %v", err)
+	}
+}
+
+func Test_BadgerStoreReadOnly(t *testing.T) {
+	path := t.TempDir()
+	store, err := hnapi.OpenBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.SaveUser(&hnapi.User{Id: "alice"})
+	store.Close()
+
+	readOnly, err := hnapi.OpenReadOnlyBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer readOnly.Close()
+	// a locked database is opened read-only if the other process opened it read-only too
+	shared, err := hnapi.OpenBadgerStore(path)
+	if err != nil {
+		t.Fatalf("Expected the read-only fallback, got %v", err)
+	}
+	defer shared.Close()
+	if !shared.ReadOnly() {
+		t.Errorf("Expected the store to be read-only")
+	}
+	if _, err := shared.LoadUser("alice"); err != nil {
+		t.Errorf("Expected the saved user, got %v", err)
+	}
+	if err := shared.SaveUser(&hnapi.User{Id: "bob"}); !errors.Is(err, hnapi.ErrStoreReadOnly) {
+		t.Errorf("Expected ErrStoreReadOnly, got %v", err)
+	}
+}
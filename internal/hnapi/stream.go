@@ -0,0 +1,233 @@
+package hnapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// the maximum size of an event's data, the biggest feeds are a few KBs
+const MAX_STREAM_EVENT_SIZE = 1024 * 1024
+
+type StreamEventType string
+
+const (
+	StreamPut   StreamEventType = "put"
+	StreamPatch StreamEventType = "patch"
+	StreamError StreamEventType = "error"
+)
+
+/*
+StreamEvent is a change of the data under a subscribed path. A put replaces the data
+at DataPath (relative to the subscribed Path, "/" is the whole data), a patch updates
+the children of DataPath listed in Data. An error event carries in Err the permanent failure
+that ended the subscription of Path.
+*/
+type StreamEvent struct {
+	Path     string
+	Type     StreamEventType
+	DataPath string
+	Data     json.RawMessage
+	Err      error
+}
+
+// Ids decodes the data of a feed's event
+func (e StreamEvent) Ids() ([]int, error) {
+	var ids []int
+	err := json.Unmarshal(e.Data, &ids)
+	return ids, err
+}
+
+// Int decodes the data of a numeric event like maxitem
+func (e StreamEvent) Int() (int, error) {
+	var value int
+	err := json.Unmarshal(e.Data, &value)
+	return value, err
+}
+
+// Item decodes the data of an item's event
+func (e StreamEvent) Item() (*Item, error) {
+	var item *Item
+	if err := json.Unmarshal(e.Data, &item); err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNotFound
+	}
+	return item, nil
+}
+
+// the payload of the firebase put and patch events
+type streamEventData struct {
+	Path string          `json:"path"`
+	Data json.RawMessage `json:"data"`
+}
+
+// ItemStreamPath returns the path to subscribe to for the changes of an item
+func ItemStreamPath(id int) string {
+	return fmt.Sprintf("item/%d", id)
+}
+
+// FeedStreamPath returns the path to subscribe to for the changes of a feed
+func FeedStreamPath(feed Feed) string {
+	return strings.TrimSuffix(feed.Path(), ".json")
+}
+
+/*
+StreamClient receives the changes of the Hacker News API as server-sent events
+*/
+type StreamClient struct {
+	client      *http.Client
+	baseUrl     string
+	retryPolicy RetryPolicy
+}
+
+/*
+NewStreamClient returns a streaming client for the API under baseUrl, the http client
+must not have a timeout as the connections are kept open
+*/
+func NewStreamClient(httpClient *http.Client, baseUrl string) *StreamClient {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if baseUrl == "" {
+		baseUrl = HN_BASE_URL
+	}
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+	return &StreamClient{httpClient, baseUrl, DefaultRetryPolicy}
+}
+
+// SetRetryPolicy sets the delays between the reconnects, MaxAttempts is ignored as it reconnects until cancelled
+func (s *StreamClient) SetRetryPolicy(policy RetryPolicy) {
+	s.retryPolicy = policy
+}
+
+/*
+Subscribe streams the events of the paths (e.g. "topstories", "maxitem", "item/8863") to the
+returned channel. The lost connections are reopened, a path whose request fails permanently
+(e.g. 404) gets an error event instead. The channel is closed when ctx is done.
+*/
+func (s *StreamClient) Subscribe(ctx context.Context, paths ...string) <-chan StreamEvent {
+	events := make(chan StreamEvent)
+	wg := sync.WaitGroup{}
+	for _, path := range paths {
+		wg.Go(func() {
+			s.subscribe(ctx, path, events)
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events
+}
+
+/*
+keeps a path subscribed, reconnecting until ctx is done, the server cancels the subscription
+or responds with a status that is not temporary
+*/
+func (s *StreamClient) subscribe(ctx context.Context, path string, events chan<- StreamEvent) {
+	attempt := 0
+	for ctx.Err() == nil {
+		received, err := s.stream(ctx, path, events)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == errStreamCancelled {
+			log.Printf("the subscription of %s was cancelled by the server", path)
+			return
+		}
+		var statusError *StatusError
+		if errors.As(err, &statusError) && !statusError.Temporary() { // e.g. a wrong path, retrying will not help
+			log.Printf("the subscription of %s failed: %v", path, err)
+			select {
+			case events <- StreamEvent{Path: path, Type: StreamError, Err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		if received {
+			attempt = 0
+		}
+		attempt++
+		log.Printf("stream of %s disconnected, reconnecting: %v", path, err)
+		if sleep(ctx, s.retryPolicy.Delay(attempt)) != nil {
+			return
+		}
+	}
+}
+
+var errStreamCancelled = errors.New("stream cancelled by the server")
+
+// reads the events of one connection, returns whether any event was received
+func (s *StreamClient) stream(ctx context.Context, path string, events chan<- StreamEvent) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseUrl+path+".json", nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return false, &StatusError{request.URL.String(), response.StatusCode}
+	}
+
+	received := false
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_STREAM_EVENT_SIZE)
+	eventType := ""
+	data := strings.Builder{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				eventType = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+			continue
+		}
+		// an empty line dispatches the event
+		switch eventType {
+		case string(StreamPut), string(StreamPatch):
+			var payload streamEventData
+			if err := json.Unmarshal([]byte(data.String()), &payload); err != nil {
+				return received, fmt.Errorf("error while decoding the %s event of %s: %w", eventType, path, err)
+			}
+			event := StreamEvent{path, StreamEventType(eventType), payload.Path, payload.Data, nil}
+			select {
+			case events <- event:
+				received = true
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+		case "cancel", "auth_revoked":
+			return received, errStreamCancelled
+		}
+		eventType = ""
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, errors.New("stream closed by the server")
+}
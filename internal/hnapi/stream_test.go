@@ -0,0 +1,118 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan hnapi.StreamEvent) hnapi.StreamEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timed out waiting for an event")
+	}
+	return hnapi.StreamEvent{}
+}
+
+func waitForStreams(t *testing.T, server *hntest.Server, path string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for server.StreamCount(path) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d stream(s) of %s", count, path)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func Test_StreamClient_Subscribe(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	client := hnapi.NewStreamClient(nil, server.BaseUrl())
+	client.SetRetryPolicy(hnapi.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond * 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	events := client.Subscribe(ctx, hnapi.FeedStreamPath(hnapi.FeedTop), hnapi.ItemStreamPath(100))
+
+	initial := map[string]hnapi.StreamEvent{}
+	for range 2 {
+		event := nextEvent(t, events)
+		initial[event.Path] = event
+	}
+	ids, err := initial["topstories"].Ids()
+	if err != nil || len(ids) != 3 || ids[0] != 100 {
+		t.Errorf("Expected the initial put of the top stories, got %v (%v)", ids, err)
+	}
+	item, err := initial["item/100"].Item()
+	if err != nil || item.Score != 120 {
+		t.Errorf("Expected the initial put of the item, got %+v (%v)", item, err)
+	}
+
+	waitForStreams(t, server, "item/100", 1)
+	server.Emit("item/100", "patch", "/", map[string]int{"score": 121})
+	event := nextEvent(t, events)
+	if event.Type != hnapi.StreamPatch || event.Path != "item/100" || string(event.Data) != `{"score":121}` {
+		t.Errorf("Unexpected patch event %+v", event)
+	}
+
+	server.CloseStreams()
+	reconnected := nextEvent(t, events)
+	if reconnected.Type != hnapi.StreamPut || reconnected.DataPath != "/" {
+		t.Errorf("Expected a put event after reconnecting, got %+v", reconnected)
+	}
+
+	cancel()
+	for range events { // the channel is closed after the subscriptions stopped
+	}
+}
+
+func Test_StreamClient_CancelledByServer(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	client := hnapi.NewStreamClient(nil, server.BaseUrl())
+	events := client.Subscribe(context.Background(), "maxitem")
+	if maxItem, err := nextEvent(t, events).Int(); err != nil || maxItem != 400 {
+		t.Errorf("Expected maxitem 400, got %d (%v)", maxItem, err)
+	}
+	waitForStreams(t, server, "maxitem", 1)
+	server.Emit("maxitem", "cancel", "", nil)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timed out waiting for the channel to be closed")
+	}
+}
+
+func Test_StreamClient_StopsOnPermanentFailure(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	server.FailNext("maxitem.json", http.StatusForbidden)
+	client := hnapi.NewStreamClient(nil, server.BaseUrl())
+	client.SetRetryPolicy(hnapi.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	events := client.Subscribe(context.Background(), "maxitem")
+	event := nextEvent(t, events)
+	var statusError *hnapi.StatusError
+	if event.Type != hnapi.StreamError || !errors.As(event.Err, &statusError) || statusError.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected an error event with the status 403, got %+v", event)
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Expected the channel to be closed")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timed out waiting for the channel to be closed")
+	}
+	if count := server.RequestCount("maxitem.json"); count != 1 {
+		t.Errorf("Expected no reconnect, got %d requests", count)
+	}
+}
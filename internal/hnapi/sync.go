@@ -0,0 +1,270 @@
+package hnapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const DEFAULT_SYNC_CONCURRENCY = 4
+const SYNC_STATE_KEY = "sync_state"
+
+// ErrOfflineSync is returned when syncing while the repository is offline
+var ErrOfflineSync = errors.New("can not sync while offline")
+
+/*
+SyncOptions selects what Sync downloads, the comment trees are walked up to Depth levels (0 means no limit)
+*/
+type SyncOptions struct {
+	Feeds       []Feed
+	StoryCount  int
+	Depth       int
+	Concurrency int // the number of stories synced at once
+}
+
+/*
+SyncProgress is reported after every synced story
+*/
+type SyncProgress struct {
+	StoriesDone  int
+	StoriesTotal int
+	Items        int
+	Users        int
+	Errors       int
+}
+
+/*
+SyncReport sums up a sync, Resumed is the number of stories skipped as they were synced by the interrupted previous run
+*/
+type SyncReport struct {
+	Feeds    int
+	Stories  int
+	Resumed  int
+	Items    int
+	Users    int
+	Errors   []error
+	Duration time.Duration
+}
+
+// the plan of a sync and its progress, saved after every story so an interrupted sync can be resumed
+type syncState struct {
+	Feeds      []string         `json:"feeds"`
+	StoryCount int              `json:"story_count"`
+	Depth      int              `json:"depth"`
+	Planned    map[string][]int `json:"planned"` // the story ids by feed
+	Done       []int            `json:"done"`
+	Authors    map[string]bool  `json:"authors"` // of the done stories and their comments
+	Finished   bool             `json:"finished"`
+}
+
+func (s *syncState) matches(options SyncOptions) bool {
+	feeds := make([]string, len(options.Feeds))
+	for i, feed := range options.Feeds {
+		feeds[i] = feed.String()
+	}
+	return !s.Finished && slices.Equal(s.Feeds, feeds) && s.StoryCount == options.StoryCount && s.Depth == options.Depth
+}
+
+func (r *Repository) loadSyncState() (*syncState, error) {
+	value, err := r.store.LoadMeta(SYNC_STATE_KEY)
+	if err != nil {
+		return nil, err
+	}
+	var state syncState
+	if err := json.Unmarshal(value, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *Repository) saveSyncState(state *syncState) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return r.store.SaveMeta(SYNC_STATE_KEY, value)
+}
+
+/*
+Sync downloads the top stories of the feeds with their comment trees and the profiles of their
+authors into the cache for reading them offline. The progress is reported after every story.
+An interrupted sync with the same options continues with the stories it did not finish.
+*/
+func (r *Repository) Sync(ctx context.Context, options SyncOptions, progress func(SyncProgress)) (*SyncReport, error) {
+	if r.IsOffline() {
+		return nil, ErrOfflineSync
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DEFAULT_SYNC_CONCURRENCY
+	}
+	start := time.Now()
+	report := &SyncReport{Feeds: len(options.Feeds)}
+
+	state, err := r.loadSyncState()
+	if err != nil && err != ErrNotCached {
+		log.Printf("error while loading the sync state, starting over: %v", err)
+	}
+	if state == nil || !state.matches(options) {
+		state, err = r.planSync(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	done := make(map[int]bool, len(state.Done))
+	for _, id := range state.Done {
+		done[id] = true
+	}
+	storyIds := make([]int, 0)
+	for _, feed := range state.Feeds {
+		for _, id := range state.Planned[feed] {
+			if !slices.Contains(storyIds, id) {
+				storyIds = append(storyIds, id)
+			}
+		}
+	}
+	pending := make([]int, 0, len(storyIds))
+	for _, id := range storyIds {
+		if done[id] {
+			report.Resumed++
+		} else {
+			pending = append(pending, id)
+		}
+	}
+
+	mutex := sync.Mutex{}
+	current := SyncProgress{StoriesDone: report.Resumed, StoriesTotal: len(storyIds)}
+	ids := make(chan int)
+	wg := sync.WaitGroup{}
+	for range options.Concurrency {
+		wg.Go(func() {
+			for id := range ids {
+				tree, err := r.GetCommentTree(ctx, id, options.Depth)
+				if ctx.Err() != nil {
+					continue
+				}
+				mutex.Lock()
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Errorf("story %d: %w", id, err))
+				}
+				if tree != nil {
+					report.Items += collectAuthors(tree, state.Authors)
+					report.Stories++
+					state.Done = append(state.Done, id)
+					if err := r.saveSyncState(state); err != nil {
+						log.Printf("error while saving the sync state: %v", err)
+					}
+				}
+				current.StoriesDone++
+				current.Items = report.Items
+				current.Errors = len(report.Errors)
+				if progress != nil {
+					progress(current)
+				}
+				mutex.Unlock()
+			}
+		})
+	}
+	for _, id := range pending {
+		select {
+		case ids <- id:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(ids)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	r.syncUsers(ctx, state.Authors, options.Concurrency, report, func() {
+		current.Users = report.Users
+		current.Errors = len(report.Errors)
+		if progress != nil {
+			progress(current)
+		}
+	})
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+	state.Finished = true
+	if err := r.saveSyncState(state); err != nil {
+		log.Printf("error while saving the sync state: %v", err)
+	}
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// fetches the feeds and picks the stories to sync
+func (r *Repository) planSync(ctx context.Context, options SyncOptions) (*syncState, error) {
+	state := &syncState{
+		StoryCount: options.StoryCount,
+		Depth:      options.Depth,
+		Planned:    make(map[string][]int),
+		Done:       make([]int, 0),
+		Authors:    make(map[string]bool),
+	}
+	for _, feed := range options.Feeds {
+		ids, err := r.GetFeedIds(ctx, feed)
+		if err != nil {
+			return nil, fmt.Errorf("error while fetching the %s feed: %w", feed, err)
+		}
+		if r.IsOffline() { // the feed is a snapshot, the network went down
+			return nil, ErrOfflineSync
+		}
+		state.Feeds = append(state.Feeds, feed.String())
+		state.Planned[feed.String()] = ids[:min(len(ids), options.StoryCount)]
+	}
+	return state, nil
+}
+
+// adds the authors of the tree to the set and returns the number of items in the tree
+func collectAuthors(node *CommentNode, authors map[string]bool) int {
+	if node.Item.By != "" {
+		authors[node.Item.By] = true
+	}
+	count := 1
+	for _, child := range node.Children {
+		count += collectAuthors(child, authors)
+	}
+	return count
+}
+
+// fetches the profiles of the authors, calling synced after each of them
+func (r *Repository) syncUsers(ctx context.Context, authors map[string]bool, concurrency int, report *SyncReport, synced func()) {
+	mutex := sync.Mutex{}
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for author := range authors {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Go(func() {
+			defer func() { <-semaphore }()
+			_, err := r.GetUser(ctx, author)
+			if ctx.Err() != nil {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("user \"%s\": %w", author, err))
+			} else {
+				report.Users++
+			}
+			synced()
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+package hnapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const DEFAULT_UPDATE_INTERVAL = time.Second * 30
+
+/*
+Updater polls the updates of the Hacker News API, marks the changed items and profiles
+in the repository and refetches the changed items that are watched (e.g. shown on the screen).
+The refetched items are delivered to the listeners registered with Repository.OnItemUpdated.
+*/
+type Updater struct {
+	repo     *Repository
+	interval time.Duration
+	mutex    sync.Mutex
+	watched  map[int]bool
+}
+
+func NewUpdater(repo *Repository, interval time.Duration) *Updater {
+	if interval <= 0 {
+		interval = DEFAULT_UPDATE_INTERVAL
+	}
+	return &Updater{repo: repo, interval: interval, watched: make(map[int]bool)}
+}
+
+// Watch replaces the set of items refetched as soon as they change
+func (u *Updater) Watch(ids []int) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.watched = make(map[int]bool, len(ids))
+	for _, id := range ids {
+		u.watched[id] = true
+	}
+}
+
+// AddWatched adds items to the set of watched items
+func (u *Updater) AddWatched(ids []int) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for _, id := range ids {
+		u.watched[id] = true
+	}
+}
+
+/*
+Run polls the updates in every interval until ctx is done
+*/
+func (u *Updater) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.Poll(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("error while polling the updates: %v", err)
+			}
+		}
+	}
+}
+
+/*
+Poll fetches the updates once and refetches the changed watched items, it does nothing
+while the repository is offline
+*/
+func (u *Updater) Poll(ctx context.Context) error {
+	updates, err := u.repo.GetUpdates(ctx)
+	if errors.Is(err, ErrNotCached) { // offline, there is nothing to refetch either
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u.repo.SetUpdatedIds(updates.Items)
+	u.repo.SetUpdatedUsers(updates.Profiles)
+
+	changed := make([]int, 0)
+	u.mutex.Lock()
+	for _, id := range updates.Items {
+		if u.watched[id] {
+			changed = append(changed, id)
+		}
+	}
+	u.mutex.Unlock()
+	if len(changed) == 0 {
+		return nil
+	}
+	_, err = u.repo.GetItems(ctx, changed)
+	return err
+}
@@ -0,0 +1,83 @@
+package hnapi_test
+
+import (
+	"context"
+	"errors"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"testing"
+)
+
+func Test_Updater_PollRefetchesWatchedItems(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	ctx := context.Background()
+	if _, err := repo.GetItems(ctx, []int{100, 200}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetUser(ctx, "alice"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	story, _ := server.Item(100)
+	story.Score = 500
+	server.AddItems(story)
+	server.SetUpdates([]int{100, 200, 999}, []string{"alice", "nobody"})
+
+	updated := make([]*hnapi.Item, 0)
+	repo.OnItemUpdated(func(item *hnapi.Item) {
+		updated = append(updated, item)
+	})
+	updater := hnapi.NewUpdater(repo, 0)
+	updater.Watch([]int{100, 300})
+	if err := updater.Poll(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(updated) != 1 || updated[0].Id != 100 || updated[0].Score != 500 {
+		t.Fatalf("Expected only the watched item 100 to be refetched with the new score, got %+v", updated)
+	}
+	if !repo.IsUpdated(200) || repo.IsUpdated(999) {
+		t.Errorf("Expected only the cached item 200 to be marked as changed")
+	}
+	if server.RequestCount("item/200.json") != 1 {
+		t.Errorf("Expected the unwatched item to be refetched only on its next get")
+	}
+	if _, err := repo.GetItem(ctx, 200); err != nil || server.RequestCount("item/200.json") != 2 {
+		t.Errorf("Expected the changed item 200 to be refetched on get, got %d requests (%v)", server.RequestCount("item/200.json"), err)
+	}
+	if _, err := repo.GetItem(ctx, 100); err != nil || server.RequestCount("item/100.json") != 2 {
+		t.Errorf("Expected the refetched item to be served from the cache again")
+	}
+
+	if _, err := repo.GetUser(ctx, "alice"); err != nil || server.RequestCount("user/alice.json") != 2 {
+		t.Errorf("Expected the changed profile to be refetched, got %d requests (%v)", server.RequestCount("user/alice.json"), err)
+	}
+}
+
+func Test_Repository_GetUpdatesOffline(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.SetOffline(true)
+	if _, err := repo.GetUpdates(context.Background()); !errors.Is(err, hnapi.ErrNotCached) {
+		t.Errorf("Expected ErrNotCached, got %v", err)
+	}
+	if count := server.RequestCount("updates.json"); count != 0 {
+		t.Errorf("Expected no request offline, got %d", count)
+	}
+}
+
+func Test_Updater_PollOffline(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	repo := newTestRepository(t, server)
+	repo.SetOffline(true)
+	updater := hnapi.NewUpdater(repo, 0)
+	updater.Watch([]int{100})
+	if err := updater.Poll(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if count := server.RequestCount("updates.json"); count != 0 {
+		t.Errorf("Expected no request while offline, got %d", count)
+	}
+}
@@ -0,0 +1,30 @@
+package hnapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// the pages of the items and of the users on the Hacker News website
+const HN_URL = "https://news.ycombinator.com/"
+const HN_ITEM_URL = HN_URL + "item?id="
+const HN_USER_URL = HN_URL + "user?id="
+
+/*
+MatchesDomain returns true if the host of the url is one of the domains or one of their
+subdomains, e.g. "blog.go.dev" matches "go.dev". The "www." prefixes and the case are ignored.
+*/
+func MatchesDomain(itemUrl string, domains ...string) bool {
+	parsed, err := url.Parse(itemUrl)
+	if err != nil || itemUrl == "" {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
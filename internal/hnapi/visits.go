@@ -0,0 +1,85 @@
+package hnapi
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+Visit records when a story was last opened and which of its comments were seen
+*/
+type Visit struct {
+	StoryId       int           `json:"story_id"`
+	VisitedAt     int64         `json:"visited_at"`     // unix time
+	CommentsCount int           `json:"comments_count"` // the number of comments of the story at the visit
+	Seen          map[int]int64 `json:"seen"`           // the unix time each comment was first seen at, by id
+}
+
+func (v *Visit) VisitedTime() time.Time {
+	return time.Unix(v.VisitedAt, 0)
+}
+
+// IsNew returns true if the comment was not seen in the previous visits, nothing is new on the first visit
+func (v *Visit) IsNew(commentId int) bool {
+	if v == nil {
+		return false
+	}
+	_, seen := v.Seen[commentId]
+	return !seen
+}
+
+// NewCommentsCount returns the number of comments the story got since the visit
+func (v *Visit) NewCommentsCount(story *Item) int {
+	if v == nil {
+		return 0
+	}
+	return max(story.CommentsCount-v.CommentsCount, 0)
+}
+
+/*
+LoadVisit returns the last visit of the story, nil if it was never opened
+*/
+func (r *Repository) LoadVisit(storyId int) (*Visit, error) {
+	visit, err := r.store.LoadVisit(storyId)
+	if errors.Is(err, ErrNotCached) {
+		return nil, nil
+	}
+	return visit, err
+}
+
+// IsRead returns true if the story was opened before
+func (r *Repository) IsRead(storyId int) bool {
+	visit, err := r.LoadVisit(storyId)
+	return err == nil && visit != nil
+}
+
+/*
+MarkVisited records the story of the tree as opened now and its comments in the tree as seen,
+it returns the previous visit to tell the new comments apart
+*/
+func (r *Repository) MarkVisited(tree *CommentNode) (*Visit, error) {
+	r.visitMutex.Lock()
+	defer r.visitMutex.Unlock()
+	previous, err := r.LoadVisit(tree.Item.Id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	visit := &Visit{StoryId: tree.Item.Id, VisitedAt: now, CommentsCount: tree.Item.CommentsCount, Seen: make(map[int]int64)}
+	if previous != nil {
+		for id, seenAt := range previous.Seen {
+			visit.Seen[id] = seenAt
+		}
+	}
+	var markSeen func(node *CommentNode)
+	markSeen = func(node *CommentNode) {
+		for _, child := range node.Children {
+			if _, ok := visit.Seen[child.Item.Id]; !ok {
+				visit.Seen[child.Item.Id] = now
+			}
+			markSeen(child)
+		}
+	}
+	markSeen(tree)
+	return previous, r.store.SaveVisit(visit)
+}
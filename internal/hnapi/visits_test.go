@@ -0,0 +1,43 @@
+package hnapi_test
+
+import (
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"testing"
+)
+
+func Test_Repository_MarkVisited(t *testing.T) {
+	repo := hnapi.NewRepositoryWithStore(nil, &config.Config{}, hnapi.NewMemoryStore())
+	defer repo.Close()
+	comment := &hnapi.CommentNode{Item: &hnapi.Item{Id: 2}, Depth: 1}
+	tree := &hnapi.CommentNode{Item: &hnapi.Item{Id: 1, CommentsCount: 1}, Children: []*hnapi.CommentNode{comment}}
+	if repo.IsRead(1) {
+		t.Errorf("Expected the story to be unread")
+	}
+	previous, err := repo.MarkVisited(tree)
+	if err != nil || previous != nil {
+		t.Fatalf("Expected no previous visit, got %v, %v", previous, err)
+	}
+	if !repo.IsRead(1) {
+		t.Errorf("Expected the story to be read")
+	}
+
+	reply := &hnapi.CommentNode{Item: &hnapi.Item{Id: 3}, Depth: 2}
+	comment.Children = append(comment.Children, reply)
+	tree.Item.CommentsCount = 2
+	visit, _ := repo.LoadVisit(1)
+	if count := visit.NewCommentsCount(tree.Item); count != 1 {
+		t.Errorf("Expected 1 new comment, got %d", count)
+	}
+	previous, err = repo.MarkVisited(tree)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if previous.IsNew(2) || !previous.IsNew(3) {
+		t.Errorf("Expected only the reply to be new")
+	}
+	visit, _ = repo.LoadVisit(1)
+	if visit.IsNew(3) || visit.NewCommentsCount(tree.Item) != 0 {
+		t.Errorf("Expected nothing new after the visit")
+	}
+}
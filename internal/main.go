@@ -3,19 +3,18 @@ package main
 import (
 	config "hnterminal/internal/config"
 	"hnterminal/internal/tui"
+	"hnterminal/internal/ui"
 )
 
 func main() {
 	currentConfig := config.New()
-	tui := tui.New(currentConfig)
-	tui.Init()
-	tui.Run()
-	// if config.IsTUI() {
-	// 	tui := ui.NewTui(currentConfig)
-	// 	tui.Run()
-	// } else {
-	// 	cli := ui.NewCli(currentConfig)
-	// 	cli.Run()
-	// 	defer cli.Close()
-	// }
+	if config.IsTUI() {
+		tui := tui.New(currentConfig)
+		tui.Init()
+		tui.Run()
+	} else {
+		cli := ui.NewCli(currentConfig)
+		defer cli.Close()
+		cli.Run()
+	}
 }
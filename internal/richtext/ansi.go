@@ -0,0 +1,43 @@
+package richtext
+
+import "strings"
+
+const ANSI_RESET = "\x1b[0m"
+const ANSI_ITALIC = "\x1b[3m"
+const ANSI_DIM = "\x1b[2m"
+const ANSI_UNDERLINE = "\x1b[4m"
+const ANSI_BLUE = "\x1b[34m"
+const ANSI_GREEN = "\x1b[32m"
+
+// ANSI returns the escape sequences of the style
+func (s Style) ANSI() string {
+	var sequences strings.Builder
+	if s.Has(Italic) {
+		sequences.WriteString(ANSI_ITALIC)
+	}
+	if s.Has(Link) {
+		sequences.WriteString(ANSI_UNDERLINE + ANSI_BLUE)
+	}
+	if s.Has(Code) {
+		sequences.WriteString(ANSI_GREEN)
+	}
+	if s.Has(Quote) {
+		sequences.WriteString(ANSI_DIM)
+	}
+	return sequences.String()
+}
+
+/*
+ANSI returns the line with its styles as ANSI escape sequences for the terminals
+*/
+func (l Line) ANSI() string {
+	var rendered strings.Builder
+	for _, span := range l {
+		if span.Style == 0 {
+			rendered.WriteString(span.Text)
+			continue
+		}
+		rendered.WriteString(span.Style.ANSI() + span.Text + ANSI_RESET)
+	}
+	return rendered.String()
+}
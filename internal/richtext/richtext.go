@@ -0,0 +1,231 @@
+/*
+Package richtext converts the HTML subset of the Hacker News texts to styled blocks of text
+that the CLI and the TUI render with their own styles
+*/
+package richtext
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Style is a combination of the styles of a span
+type Style int
+
+const (
+	Italic Style = 1 << iota
+	Link
+	Code
+	Quote
+)
+
+func (s Style) Has(style Style) bool {
+	return s&style != 0
+}
+
+/*
+Span is a run of text with the same style, Url is the target of the links
+*/
+type Span struct {
+	Text  string
+	Style Style
+	Url   string
+}
+
+type BlockKind int
+
+const (
+	Paragraph  BlockKind = iota
+	CodeBlock            // preformatted, the lines are kept as they are
+	QuoteBlock           // a paragraph starting with ">", the ">" is removed
+)
+
+type Block struct {
+	Kind  BlockKind
+	Spans []Span
+}
+
+// Text returns the text of the block without the styles
+func (b Block) Text() string {
+	var text strings.Builder
+	for _, span := range b.Spans {
+		text.WriteString(span.Text)
+	}
+	return text.String()
+}
+
+func (b *Block) add(span Span) {
+	b.Spans = appendSpan(b.Spans, span)
+}
+
+// the span is merged into the last one if they have the same style
+func appendSpan(spans []Span, span Span) []Span {
+	if span.Text == "" {
+		return spans
+	}
+	if last := len(spans) - 1; last >= 0 && spans[last].Style == span.Style && spans[last].Url == span.Url {
+		spans[last].Text += span.Text
+		return spans
+	}
+	return append(spans, span)
+}
+
+/*
+Document is a text made of paragraphs, code blocks and quotes
+*/
+type Document []Block
+
+// PlainText returns the text of the document, the blocks are separated by empty lines
+func (d Document) PlainText() string {
+	blocks := make([]string, len(d))
+	for i, block := range d {
+		blocks[i] = block.Text()
+		if block.Kind == QuoteBlock {
+			blocks[i] = "> " + blocks[i]
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+var tagRegexp = regexp.MustCompile(`<(/?)([a-zA-Z]+)([^>]*)>`)
+var hrefRegexp = regexp.MustCompile(`href="([^"]*)"`)
+var spacesRegexp = regexp.MustCompile(`\s+`)
+
+/*
+Parse converts the HTML of an item's text to a document. It knows the tags used by Hacker News:
+<p>, <i>, <a href>, <pre> and <code>, the other tags are dropped and their text is kept.
+*/
+func Parse(text string) Document {
+	parser := parser{}
+	position := 0
+	for _, match := range tagRegexp.FindAllStringSubmatchIndex(text, -1) {
+		parser.text(text[position:match[0]])
+		position = match[1]
+		closing := match[3] > match[2]
+		name := strings.ToLower(text[match[4]:match[5]])
+		parser.tag(name, closing, text[match[6]:match[7]])
+	}
+	parser.text(text[position:])
+	parser.endBlock()
+	return parser.document
+}
+
+type parser struct {
+	document Document
+	block    *Block
+	italic   int
+	url      string
+	pre      bool
+	code     bool
+}
+
+func (p *parser) style() Style {
+	style := Style(0)
+	if p.italic > 0 {
+		style |= Italic
+	}
+	if p.url != "" {
+		style |= Link
+	}
+	if p.code || p.pre {
+		style |= Code
+	}
+	return style
+}
+
+func (p *parser) text(text string) {
+	if text == "" {
+		return
+	}
+	text = html.UnescapeString(text)
+	if p.pre {
+		p.startBlock(CodeBlock)
+	} else {
+		// the line breaks are made with <p>, the new lines are spaces like in a browser
+		text = spacesRegexp.ReplaceAllString(text, " ")
+		if p.block == nil && strings.TrimSpace(text) == "" {
+			return
+		}
+		p.startBlock(Paragraph)
+		// the long links are shortened with "..." by Hacker News
+		if shortened, ok := strings.CutSuffix(text, "..."); ok && p.url != "" && strings.HasPrefix(p.url, shortened) {
+			text = p.url
+		}
+	}
+	p.block.add(Span{text, p.style(), p.url})
+}
+
+func (p *parser) tag(name string, closing bool, attributes string) {
+	switch name {
+	case "p":
+		p.endBlock()
+	case "i", "em":
+		if closing {
+			p.italic = max(p.italic-1, 0)
+		} else {
+			p.italic++
+		}
+	case "a":
+		p.url = ""
+		if match := hrefRegexp.FindStringSubmatch(attributes); match != nil && !closing {
+			p.url = html.UnescapeString(match[1])
+		}
+	case "pre":
+		p.endBlock()
+		p.pre = !closing
+	case "code":
+		p.code = !closing
+	case "br":
+		if p.pre {
+			p.text("\n")
+		} else {
+			p.endBlock()
+		}
+	}
+}
+
+func (p *parser) startBlock(kind BlockKind) {
+	if p.block != nil && p.block.Kind != kind {
+		p.endBlock()
+	}
+	if p.block == nil {
+		p.block = &Block{Kind: kind}
+	}
+}
+
+// adds the current block to the document, trimming its spaces
+func (p *parser) endBlock() {
+	block := p.block
+	p.block = nil
+	if block == nil || len(block.Spans) == 0 {
+		return
+	}
+	spans := block.Spans
+	if block.Kind == CodeBlock {
+		spans[0].Text = strings.TrimLeft(spans[0].Text, "\n")
+		spans[len(spans)-1].Text = strings.TrimRight(spans[len(spans)-1].Text, "\n ")
+	} else {
+		spans[0].Text = strings.TrimLeft(spans[0].Text, " ")
+		spans[len(spans)-1].Text = strings.TrimRight(spans[len(spans)-1].Text, " ")
+		if quote, ok := strings.CutPrefix(spans[0].Text, ">"); ok {
+			block.Kind = QuoteBlock
+			spans[0].Text = strings.TrimLeft(quote, " ")
+			for i := range spans {
+				spans[i].Style |= Quote
+			}
+		}
+	}
+	// drops the spans emptied by the trimming
+	kept := spans[:0]
+	for _, span := range spans {
+		if span.Text != "" {
+			kept = append(kept, span)
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+	block.Spans = kept
+	p.document = append(p.document, *block)
+}
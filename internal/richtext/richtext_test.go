@@ -0,0 +1,65 @@
+package richtext_test
+
+import (
+	"hnterminal/internal/richtext"
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	document := richtext.Parse(`I&#x27;d love <i>vim</i> key bindings, see <a href="https:&#x2F;&#x2F;example.com&#x2F;a&#x2F;long&#x2F;path" rel="nofollow">https:&#x2F;&#x2F;example.com&#x2F;a&#x2F;...</a><p>&gt; a quote
+spanning lines<p>Code:<pre><code>  if x {
+    y()
+  }
+</code></pre>After the code.`)
+	if len(document) != 5 {
+		t.Fatalf("Expected 5 blocks, got %d: %+v", len(document), document)
+	}
+	first := document[0]
+	if first.Kind != richtext.Paragraph || first.Text() != "I'd love vim key bindings, see https://example.com/a/long/path" {
+		t.Errorf("Expected the unescaped paragraph with the full url, got \"%s\"", first.Text())
+	}
+	if len(first.Spans) != 4 || first.Spans[1].Text != "vim" || !first.Spans[1].Style.Has(richtext.Italic) {
+		t.Errorf("Expected vim to be italic, got %+v", first.Spans)
+	}
+	if link := first.Spans[3]; !link.Style.Has(richtext.Link) || link.Url != "https://example.com/a/long/path" {
+		t.Errorf("Expected the link, got %+v", link)
+	}
+	if quote := document[1]; quote.Kind != richtext.QuoteBlock || quote.Text() != "a quote spanning lines" {
+		t.Errorf("Expected the quote without its marker, got %d \"%s\"", quote.Kind, quote.Text())
+	}
+	if code := document[3]; code.Kind != richtext.CodeBlock || code.Text() != "  if x {\n    y()\n  }" {
+		t.Errorf("Expected the code with its spaces and new lines, got \"%s\"", code.Text())
+	}
+	if last := document[4]; last.Kind != richtext.Paragraph || last.Text() != "After the code." {
+		t.Errorf("Expected the paragraph after the code, got \"%s\"", last.Text())
+	}
+}
+
+func Test_Document_Wrap(t *testing.T) {
+	document := richtext.Parse(`one two <i>three four</i> five<p>&gt; six seven eight<pre><code>a very long line of code</code></pre>`)
+	expected := []string{"one two three", "four five", "", "> six seven", "> eight", "", "  a very long line of code"}
+	lines := document.Wrap(13)
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i, line := range lines {
+		if line.String() != expected[i] {
+			t.Errorf("Expected line %d to be \"%s\", got \"%s\"", i, expected[i], line.String())
+		}
+	}
+	// the space between the italic words is italic too
+	if spans := lines[1]; len(spans) != 2 || spans[0].Text != "four" || spans[1].Text != " five" {
+		t.Errorf("Expected the italic word then the plain text, got %+v", spans)
+	}
+	if spans := lines[0]; spans[len(spans)-1].Text != "three" || !spans[len(spans)-1].Style.Has(richtext.Italic) {
+		t.Errorf("Expected the line to end with the italic word, got %+v", spans)
+	}
+}
+
+func Test_Line_ANSI(t *testing.T) {
+	lines := richtext.Parse(`plain <i>italic</i>`).Wrap(80)
+	expected := "plain " + richtext.ANSI_ITALIC + "italic" + richtext.ANSI_RESET
+	if rendered := lines[0].ANSI(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
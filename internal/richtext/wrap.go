@@ -0,0 +1,112 @@
+package richtext
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const QUOTE_PREFIX = "> "
+const CODE_INDENT = "  "
+
+/*
+Line is a line of a wrapped document
+*/
+type Line []Span
+
+// String returns the text of the line without the styles
+func (l Line) String() string {
+	var text strings.Builder
+	for _, span := range l {
+		text.WriteString(span.Text)
+	}
+	return text.String()
+}
+
+// Width returns the number of runes of the line
+func (l Line) Width() int {
+	width := 0
+	for _, span := range l {
+		width += utf8.RuneCountInString(span.Text)
+	}
+	return width
+}
+
+/*
+Wrap breaks the blocks of the document to lines of at most width runes, the blocks are separated
+by empty lines. The quotes are prefixed with QUOTE_PREFIX, the lines of the code blocks are indented
+with CODE_INDENT and are not wrapped. The words longer than a line are not broken.
+*/
+func (d Document) Wrap(width int) []Line {
+	lines := make([]Line, 0)
+	for i, block := range d {
+		if i > 0 {
+			lines = append(lines, Line{})
+		}
+		switch block.Kind {
+		case CodeBlock:
+			for codeLine := range strings.SplitSeq(block.Text(), "\n") {
+				lines = append(lines, Line{{CODE_INDENT + codeLine, Code, ""}})
+			}
+		case QuoteBlock:
+			lines = append(lines, wrapWords(words(block.Spans), width, Span{QUOTE_PREFIX, Quote, ""})...)
+		default:
+			lines = append(lines, wrapWords(words(block.Spans), width, Span{})...)
+		}
+	}
+	return lines
+}
+
+// splits the spans at the spaces, a word may have several styles
+func words(spans []Span) []Line {
+	words := make([]Line, 0)
+	var word Line
+	for _, span := range spans {
+		for i, part := range strings.Split(span.Text, " ") {
+			if i > 0 && len(word) > 0 {
+				words = append(words, word)
+				word = nil
+			}
+			word = appendSpan(word, Span{part, span.Style, span.Url})
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+	return words
+}
+
+// fills the lines with the words, every line starts with the prefix
+func wrapWords(words []Line, width int, prefix Span) []Line {
+	lines := make([]Line, 0)
+	available := max(width-utf8.RuneCountInString(prefix.Text), 1)
+	var line Line
+	length := 0
+	for _, word := range words {
+		wordLength := word.Width()
+		if line != nil && length+1+wordLength > available {
+			lines = append(lines, line)
+			line = nil
+		}
+		if line == nil {
+			line = appendSpan(Line{}, prefix)
+			length = 0
+		} else {
+			// the space inside of a link or an italic text keeps its style
+			last, next := line[len(line)-1], word[0]
+			separator := Span{" ", last.Style & next.Style & Quote, ""}
+			if last.Style == next.Style && last.Url == next.Url {
+				separator = Span{" ", last.Style, last.Url}
+			}
+			line = appendSpan(line, separator)
+			length++
+		}
+		for _, span := range word {
+			line = appendSpan(line, span)
+		}
+		length += wordLength
+	}
+	if line != nil {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,312 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/richtext"
+	"iter"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Action int
+
+const (
+	Hide Action = iota
+	Downrank
+)
+
+func (a Action) String() string {
+	if a == Downrank {
+		return "downrank"
+	}
+	return "hide"
+}
+
+// the kinds of items a rule applies to
+type target int
+
+const (
+	allItems target = iota
+	stories
+	comments
+)
+
+/*
+Rule hides or down-ranks the items matching all of its conditions. The score and comment
+thresholds match the stories below them, the title only matches the items with a title and
+the text the items with a text, e.g. the comments.
+*/
+type Rule struct {
+	Name        string
+	Action      Action
+	target      target
+	domains     []string
+	authors     []string
+	title       *regexp.Regexp
+	text        *regexp.Regexp
+	minScore    int
+	minComments int
+}
+
+/*
+Compile compiles the rules of the config file, the rules without a name are named after their conditions
+*/
+func Compile(configs []config.RuleConfig) (*Engine, error) {
+	engine := &Engine{rules: make([]*Rule, 0, len(configs))}
+	for i, ruleConfig := range configs {
+		rule, err := compileRule(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		engine.rules = append(engine.rules, rule)
+	}
+	return engine, nil
+}
+
+func compileRule(ruleConfig config.RuleConfig) (*Rule, error) {
+	rule := &Rule{Name: ruleConfig.Name, minScore: ruleConfig.MinScore, minComments: ruleConfig.MinComments}
+	switch strings.ToLower(ruleConfig.Action) {
+	case "", "hide":
+		rule.Action = Hide
+	case "downrank":
+		rule.Action = Downrank
+	default:
+		return nil, fmt.Errorf("unknown action \"%s\", expected hide or downrank", ruleConfig.Action)
+	}
+	switch strings.ToLower(ruleConfig.Items) {
+	case "", "all":
+		rule.target = allItems
+	case "stories":
+		rule.target = stories
+	case "comments":
+		rule.target = comments
+	default:
+		return nil, fmt.Errorf("unknown items \"%s\", expected stories, comments or all", ruleConfig.Items)
+	}
+	for _, domain := range ruleConfig.Domains {
+		rule.domains = append(rule.domains, strings.TrimPrefix(strings.ToLower(domain), "www."))
+	}
+	rule.authors = ruleConfig.Authors
+	if ruleConfig.Title != "" {
+		title, err := regexp.Compile(ruleConfig.Title)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title: %w", err)
+		}
+		rule.title = title
+	}
+	if ruleConfig.Text != "" {
+		text, err := regexp.Compile(ruleConfig.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid text: %w", err)
+		}
+		rule.text = text
+	}
+	conditions := rule.conditions()
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("no domains, authors, title, text, min_score or min_comments")
+	}
+	if rule.Name == "" {
+		rule.Name = strings.Join(conditions, " and ")
+	}
+	return rule, nil
+}
+
+// describes the conditions of the rule
+func (r *Rule) conditions() []string {
+	conditions := make([]string, 0, 6)
+	if len(r.domains) > 0 {
+		conditions = append(conditions, "domain "+strings.Join(r.domains, "|"))
+	}
+	if len(r.authors) > 0 {
+		conditions = append(conditions, "by "+strings.Join(r.authors, "|"))
+	}
+	if r.title != nil {
+		conditions = append(conditions, fmt.Sprintf("title /%s/", r.title))
+	}
+	if r.text != nil {
+		conditions = append(conditions, fmt.Sprintf("text /%s/", r.text))
+	}
+	if r.minScore > 0 {
+		conditions = append(conditions, fmt.Sprintf("score < %d", r.minScore))
+	}
+	if r.minComments > 0 {
+		conditions = append(conditions, fmt.Sprintf("comments < %d", r.minComments))
+	}
+	return conditions
+}
+
+// Match returns true if the item matches all the conditions of the rule
+func (r *Rule) Match(item *hnapi.Item) bool {
+	isComment := item.Type == "comment"
+	if (r.target == stories && isComment) || (r.target == comments && !isComment) {
+		return false
+	}
+	if len(r.domains) > 0 && !hnapi.MatchesDomain(item.Url, r.domains...) {
+		return false
+	}
+	if len(r.authors) > 0 && !slices.ContainsFunc(r.authors, func(author string) bool { return strings.EqualFold(item.By, author) }) {
+		return false
+	}
+	if r.title != nil && (item.Title == "" || !r.title.MatchString(item.Title)) {
+		return false
+	}
+	if r.text != nil && (item.Text == "" || !r.text.MatchString(richtext.Parse(item.Text).PlainText())) {
+		return false
+	}
+	// the API has no scores for the comments
+	if r.minScore > 0 && (isComment || item.Score >= r.minScore) {
+		return false
+	}
+	if r.minComments > 0 && (isComment || item.CommentsCount >= r.minComments) {
+		return false
+	}
+	return true
+}
+
+/*
+Hidden counts the items hidden by each rule, by the name of the rule
+*/
+type Hidden map[string]int
+
+// String lists the rules that hid the most items first, e.g. `2 by "domain example.com", 1 by "by bob"`
+func (h Hidden) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if h[a] != h[b] {
+			return h[b] - h[a]
+		}
+		return strings.Compare(a, b)
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d by \"%s\"", h[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+/*
+Engine applies the rules to the lists of stories and to the comment trees. The first matching
+rule decides what happens to an item. A nil engine keeps every item, e.g. with --no-filter.
+*/
+type Engine struct {
+	rules []*Rule
+}
+
+// Match returns the first rule matching the item, nil if the item is kept as is
+func (e *Engine) Match(item *hnapi.Item) *Rule {
+	if e == nil || item == nil {
+		return nil
+	}
+	for _, rule := range e.rules {
+		if rule.Match(item) {
+			return rule
+		}
+	}
+	return nil
+}
+
+/*
+Filter returns the items without the hidden ones and with the down-ranked ones moved after
+the others, the hidden items are counted in hidden
+*/
+func (e *Engine) Filter(items []*hnapi.Item, hidden Hidden) []*hnapi.Item {
+	kept := make([]*hnapi.Item, 0, len(items))
+	downranked := make([]*hnapi.Item, 0)
+	for _, item := range items {
+		rule := e.Match(item)
+		switch {
+		case rule == nil:
+			kept = append(kept, item)
+		case rule.Action == Downrank:
+			downranked = append(downranked, item)
+		default:
+			hidden[rule.Name]++
+		}
+	}
+	return append(kept, downranked...)
+}
+
+/*
+FilterTree removes the hidden comments along with their replies from the tree and moves the
+down-ranked comments after their siblings, the hidden comments are counted in hidden
+*/
+func (e *Engine) FilterTree(node *hnapi.CommentNode, hidden Hidden) {
+	if e == nil {
+		return
+	}
+	kept := make([]*hnapi.CommentNode, 0, len(node.Children))
+	downranked := make([]*hnapi.CommentNode, 0)
+	for _, child := range node.Children {
+		rule := e.Match(child.Item)
+		switch {
+		case rule == nil:
+			kept = append(kept, child)
+		case rule.Action == Downrank:
+			downranked = append(downranked, child)
+		default:
+			hidden[rule.Name]++
+			continue
+		}
+		e.FilterTree(child, hidden)
+	}
+	node.Children = append(kept, downranked...)
+}
+
+/*
+StreamStories streams the first count stories of ids like Repository.StreamItems, the hidden
+stories are replaced by the next ones of ids so that count stories are shown when possible.
+The down-ranked stories are yielded after the others, the Index of the results, including
+the errors, is their position in the filtered list. The hidden stories are counted in hidden.
+*/
+func (e *Engine) StreamStories(ctx context.Context, repo *hnapi.Repository, ids []int, count int, hidden Hidden) iter.Seq[hnapi.ItemResult] {
+	return func(yield func(hnapi.ItemResult) bool) {
+		downranked := make([]hnapi.ItemResult, 0)
+		shown := 0
+		next := 0
+		missing := count
+		for missing > 0 && next < len(ids) && ctx.Err() == nil {
+			batch := ids[next:min(next+missing, len(ids))]
+			next += len(batch)
+			missing = 0
+			for result := range repo.StreamItems(ctx, batch) {
+				if result.Err != nil {
+					result.Index = shown
+					shown++
+					if !yield(result) {
+						return
+					}
+					continue
+				}
+				rule := e.Match(result.Item)
+				if rule != nil && rule.Action == Hide {
+					hidden[rule.Name]++
+					missing++
+					continue
+				}
+				if rule != nil {
+					downranked = append(downranked, result)
+					continue
+				}
+				result.Index = shown
+				shown++
+				if !yield(result) {
+					return
+				}
+			}
+		}
+		for _, result := range downranked {
+			result.Index = shown
+			shown++
+			if !yield(result) {
+				return
+			}
+		}
+	}
+}
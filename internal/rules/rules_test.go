@@ -0,0 +1,187 @@
+package rules_test
+
+import (
+	"context"
+	"fmt"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"hnterminal/internal/rules"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, configs ...config.RuleConfig) *rules.Engine {
+	engine, err := rules.Compile(configs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return engine
+}
+
+func ids(items []*hnapi.Item) string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = fmt.Sprint(item.Id)
+	}
+	return strings.Join(ids, " ")
+}
+
+func newTestItems() []*hnapi.Item {
+	return []*hnapi.Item{
+		{Id: 1, Type: "story", By: "alice", Score: 120, Title: "Rust in the kernel", Url: "https://www.lwn.net/articles/1", CommentsCount: 42},
+		{Id: 2, Type: "story", By: "bob", Score: 15, Title: "Ask HN: Is crypto dead?", CommentsCount: 3},
+		{Id: 3, Type: "story", By: "carol", Score: 300, Title: "Go 1.25 released", Url: "https://blog.go.dev/go1.25", CommentsCount: 80},
+		{Id: 4, Type: "comment", By: "Bob", Text: "Buy <i>crypto</i> now"},
+	}
+}
+
+func Test_Rule_Match(t *testing.T) {
+	tests := []struct {
+		rule     config.RuleConfig
+		expected string
+	}{
+		{config.RuleConfig{Domains: []string{"go.dev"}}, "1 2 4"},
+		{config.RuleConfig{Domains: []string{"www.LWN.net"}}, "2 3 4"},
+		{config.RuleConfig{Authors: []string{"bob"}}, "1 3"},
+		{config.RuleConfig{Authors: []string{"bob"}, Items: "stories"}, "1 3 4"},
+		{config.RuleConfig{Title: "(?i)crypto"}, "1 3 4"},
+		{config.RuleConfig{Text: "(?i)crypto"}, "1 2 3"},
+		{config.RuleConfig{Text: "(?i)crypto", Items: "stories"}, "1 2 3 4"},
+		{config.RuleConfig{MinScore: 100}, "1 3 4"},
+		{config.RuleConfig{MinComments: 50}, "3 4"},
+		{config.RuleConfig{MinScore: 100, MinComments: 50}, "1 3 4"},
+	}
+	for _, test := range tests {
+		hidden := rules.Hidden{}
+		if kept := ids(compile(t, test.rule).Filter(newTestItems(), hidden)); kept != test.expected {
+			t.Errorf("Expected %+v to keep %s, got %s", test.rule, test.expected, kept)
+		}
+	}
+}
+
+func Test_Compile_Errors(t *testing.T) {
+	for _, rule := range []config.RuleConfig{
+		{},
+		{Title: "("},
+		{Text: "("},
+		{Authors: []string{"bob"}, Action: "delete"},
+		{Authors: []string{"bob"}, Items: "users"},
+	} {
+		if _, err := rules.Compile([]config.RuleConfig{rule}); err == nil {
+			t.Errorf("Expected an error for %+v", rule)
+		}
+	}
+}
+
+func Test_Engine_FilterCountsAndDownranks(t *testing.T) {
+	engine := compile(t,
+		config.RuleConfig{Name: "no crypto", Title: "(?i)crypto"},
+		config.RuleConfig{Name: "no crypto", Text: "(?i)crypto"},
+		config.RuleConfig{Domains: []string{"lwn.net"}, Action: "downrank"},
+		config.RuleConfig{Authors: []string{"carol", "bob"}},
+	)
+	hidden := rules.Hidden{}
+	kept := engine.Filter(newTestItems(), hidden)
+	if ids(kept) != "1" {
+		t.Errorf("Expected only the down-ranked story, got %s", ids(kept))
+	}
+	if hidden.String() != `2 by "no crypto", 1 by "by carol|bob"` {
+		t.Errorf("Unexpected hidden counts %s", hidden)
+	}
+
+	engine = compile(t, config.RuleConfig{Domains: []string{"lwn.net"}, Action: "downrank"})
+	if kept := ids(engine.Filter(newTestItems(), rules.Hidden{})); kept != "2 3 4 1" {
+		t.Errorf("Expected the down-ranked story last, got %s", kept)
+	}
+
+	var noFilter *rules.Engine
+	if kept := ids(noFilter.Filter(newTestItems(), rules.Hidden{})); kept != "1 2 3 4" {
+		t.Errorf("Expected a nil engine to keep every item, got %s", kept)
+	}
+}
+
+func Test_Engine_FilterTree(t *testing.T) {
+	tree := &hnapi.CommentNode{Item: &hnapi.Item{Id: 100, Type: "story"}, Children: []*hnapi.CommentNode{
+		{Item: &hnapi.Item{Id: 101, Type: "comment", By: "bob"}, Depth: 1, Children: []*hnapi.CommentNode{
+			{Item: &hnapi.Item{Id: 103, Type: "comment", By: "alice"}, Depth: 2},
+		}},
+		{Item: &hnapi.Item{Id: 102, Type: "comment", By: "spammer"}, Depth: 1, Children: []*hnapi.CommentNode{
+			{Item: &hnapi.Item{Id: 104, Type: "comment", By: "alice"}, Depth: 2},
+		}},
+		{Item: &hnapi.Item{Id: 105, Type: "comment", By: "carol"}, Depth: 1},
+	}}
+	engine := compile(t,
+		config.RuleConfig{Authors: []string{"spammer"}},
+		config.RuleConfig{Authors: []string{"bob"}, Action: "downrank"},
+	)
+	hidden := rules.Hidden{}
+	engine.FilterTree(tree, hidden)
+	if len(tree.Children) != 2 || tree.Children[0].Item.Id != 105 || tree.Children[1].Item.Id != 101 {
+		t.Fatalf("Expected the comment of carol then the down-ranked one of bob, got %+v", tree.Children)
+	}
+	if len(tree.Children[1].Children) != 1 {
+		t.Errorf("Expected the replies of the down-ranked comment to be kept")
+	}
+	if hidden["by spammer"] != 1 {
+		t.Errorf("Expected the comment of spammer to be hidden with its replies once, got %v", hidden)
+	}
+}
+
+func Test_Engine_StreamStoriesReplacesTheHiddenOnes(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	api := hnapi.NewApiClient(nil, server.BaseUrl())
+	repo, err := hnapi.NewRepository(api, &config.Config{DbPath: t.TempDir(), BaseUrl: server.BaseUrl()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer repo.Close()
+	engine := compile(t,
+		config.RuleConfig{Domains: []string{"go.dev"}},
+		config.RuleConfig{Authors: []string{"alice"}, Action: "downrank"},
+	)
+	hidden := rules.Hidden{}
+	streamed := make([]string, 0)
+	for result := range engine.StreamStories(context.Background(), repo, []int{100, 200, 300, 400}, 2, hidden) {
+		if result.Err != nil {
+			t.Fatalf("Expected no error, got %v", result.Err)
+		}
+		streamed = append(streamed, fmt.Sprintf("%d:%d", result.Index, result.Id))
+	}
+	if strings.Join(streamed, " ") != "0:300 1:100" {
+		t.Errorf("Expected the hidden story to be replaced and the down-ranked one last, got %v", streamed)
+	}
+	if hidden["domain go.dev"] != 1 {
+		t.Errorf("Expected the go.dev story to be counted, got %v", hidden)
+	}
+	if count := server.RequestCount("item/400.json"); count != 0 {
+		t.Errorf("Expected the stories after the count not to be fetched, got %d requests", count)
+	}
+}
+
+func Test_Engine_StreamStoriesPositionsTheErrors(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	api := hnapi.NewApiClient(nil, server.BaseUrl())
+	repo, err := hnapi.NewRepository(api, &config.Config{DbPath: t.TempDir(), BaseUrl: server.BaseUrl()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer repo.Close()
+	engine := compile(t, config.RuleConfig{Domains: []string{"go.dev"}})
+	positions := make(map[int]bool)
+	failed := 0
+	for result := range engine.StreamStories(context.Background(), repo, []int{999, 100, 300, 200}, 3, rules.Hidden{}) {
+		if result.Err != nil {
+			failed++
+		}
+		if positions[result.Index] || result.Index < 0 || result.Index >= 3 {
+			t.Errorf("Expected a distinct position in the list for %d, got %d", result.Id, result.Index)
+		}
+		positions[result.Index] = true
+	}
+	if failed != 1 || len(positions) != 3 {
+		t.Errorf("Expected the unknown story and the 2 kept stories, got %d errors and %d positions", failed, len(positions))
+	}
+}
@@ -0,0 +1,486 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/utils"
+	"log"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the version of the layout of the index, an index with another version is rebuilt when opened
+const INDEX_VERSION = 1
+const INDEX_KEY_PREFIX = "index/"
+const INDEX_STATS_KEY = "search_index"
+
+// the number of cached items indexed per write while rebuilding
+const REBUILD_BATCH_SIZE = 500
+
+// the weights of the words by where they are in the item
+const TITLE_WEIGHT = 3
+const AUTHOR_WEIGHT = 2
+const URL_WEIGHT = 1
+const TEXT_WEIGHT = 1
+
+// the parameters of the BM25 ranking
+const BM25_K1 = 1.2
+const BM25_B = 0.75
+
+/*
+Index is an inverted index of the titles, texts, urls and authors of the cached items,
+kept in the store of the repository next to the items
+*/
+type Index struct {
+	store hnapi.Store
+	mutex sync.Mutex
+	stats indexStats
+	// closed when the rebuild started by Attach is over, nil if there is none
+	rebuilt chan struct{}
+}
+
+type indexStats struct {
+	Version int   `json:"version"`
+	Docs    int   `json:"docs"`
+	Length  int64 `json:"length"` // the sum of the lengths of the documents
+}
+
+// the indexed fields of an item along with its terms to remove its postings on updates
+type document struct {
+	Id     int            `json:"id"`
+	By     string         `json:"by"`
+	Type   string         `json:"type"`
+	Score  int            `json:"score"`
+	Time   int            `json:"time"`
+	Length int            `json:"length"`
+	Terms  map[string]int `json:"terms"` // the weighted frequencies of the words
+}
+
+func documentKey(id int) string {
+	return INDEX_KEY_PREFIX + "doc/" + strconv.Itoa(id)
+}
+
+func termPrefix(term string) string {
+	return INDEX_KEY_PREFIX + "term/" + term + "/"
+}
+
+func postingKey(term string, id int) string {
+	return termPrefix(term) + strconv.Itoa(id)
+}
+
+/*
+Open returns the index of the store, building it from the cached items if the store has no index yet
+*/
+func Open(store hnapi.Store) (*Index, error) {
+	index, err := open(store)
+	if err != nil {
+		return nil, err
+	}
+	if index.stats.Version != INDEX_VERSION && !store.ReadOnly() {
+		if err := index.Rebuild(context.Background()); err != nil {
+			return nil, fmt.Errorf("error while building the search index: %w", err)
+		}
+	}
+	return index, nil
+}
+
+// returns the index of the store as it is
+func open(store hnapi.Store) (*Index, error) {
+	index := &Index{store: store}
+	value, err := store.LoadMeta(INDEX_STATS_KEY)
+	if err != nil && !errors.Is(err, hnapi.ErrNotCached) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(value, &index.stats); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+/*
+Attach opens the index of the cache of the repository and keeps it up to date with the cached
+items, the index of a read-only cache can be searched but is not updated. A missing or outdated
+index is rebuilt in the background, the searches only find the items indexed so far meanwhile.
+*/
+func Attach(repo *hnapi.Repository) (*Index, error) {
+	index, err := open(repo.Store())
+	if err != nil {
+		return nil, err
+	}
+	if repo.Store().ReadOnly() {
+		return index, nil
+	}
+	repo.SetIndexer(index)
+	if index.stats.Version != INDEX_VERSION {
+		index.rebuilt = make(chan struct{})
+		repo.RunInBackground(func(ctx context.Context) {
+			defer close(index.rebuilt)
+			if err := index.Rebuild(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("error while building the search index: %v", err)
+			}
+		})
+	}
+	return index, nil
+}
+
+// WaitRebuilt waits until the rebuild started in the background by Attach is over, if any
+func (i *Index) WaitRebuilt(ctx context.Context) error {
+	if i.rebuilt == nil {
+		return nil
+	}
+	select {
+	case <-i.rebuilt:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+Rebuild drops the index and indexes every cached item again. The index keeps the version 0
+until it is complete, so that an interrupted rebuild starts over the next time it is opened.
+*/
+func (i *Index) Rebuild(ctx context.Context) error {
+	start := time.Now()
+	i.mutex.Lock()
+	stale := make([]string, 0)
+	err := i.store.Scan(INDEX_KEY_PREFIX, func(key string, value []byte) error {
+		stale = append(stale, key)
+		return nil
+	})
+	if err == nil {
+		err = i.store.WriteBatch(nil, stale)
+	}
+	if err == nil {
+		i.stats = indexStats{}
+	}
+	i.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	batch := make([]*hnapi.Item, 0, REBUILD_BATCH_SIZE)
+	err = i.store.Scan(hnapi.ITEM_KEY_PREFIX, func(key string, value []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var cached hnapi.CachedItem
+		if err := json.Unmarshal(value, &cached); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		batch = append(batch, cached.Item)
+		if len(batch) < REBUILD_BATCH_SIZE {
+			return nil
+		}
+		err := i.IndexItems(batch)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil {
+		err = i.IndexItems(batch)
+	}
+	if err != nil {
+		return err
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	stats := i.stats
+	stats.Version = INDEX_VERSION
+	if err := i.saveStats(nil, stats); err != nil {
+		return err
+	}
+	i.stats = stats
+	log.Printf("indexed %d items in %v", stats.Docs, time.Since(start))
+	return nil
+}
+
+// saves the stats with the batch, or alone if batch is nil
+func (i *Index) saveStats(batch map[string][]byte, stats indexStats) error {
+	value, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	if batch == nil {
+		return i.store.SaveMeta(INDEX_STATS_KEY, value)
+	}
+	batch[hnapi.META_KEY_PREFIX+INDEX_STATS_KEY] = value
+	return nil
+}
+
+func (i *Index) loadDocument(id int) (*document, error) {
+	value, err := i.store.Get(documentKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var doc document
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// returns the document of the item with the weighted frequencies of its words
+func newDocument(item *hnapi.Item) *document {
+	doc := &document{Id: item.Id, By: item.By, Type: item.Type, Score: item.Score, Time: item.Time, Terms: make(map[string]int)}
+	add := func(text string, weight int) {
+		for _, term := range Tokenize(text) {
+			doc.Terms[term] += weight
+			doc.Length += weight
+		}
+	}
+	add(item.Title, TITLE_WEIGHT)
+	add(item.By, AUTHOR_WEIGHT)
+	if parsed, err := url.Parse(item.Url); err == nil && item.Url != "" {
+		add(strings.TrimPrefix(parsed.Hostname(), "www.")+" "+parsed.Path, URL_WEIGHT)
+	}
+	add(utils.HtmlToText(item.Text), TEXT_WEIGHT)
+	return doc
+}
+
+/*
+IndexItem adds the item to the index or updates it, the deleted items are removed
+*/
+func (i *Index) IndexItem(item *hnapi.Item) error {
+	return i.IndexItems([]*hnapi.Item{item})
+}
+
+// RemoveItem removes the item from the index
+func (i *Index) RemoveItem(id int) error {
+	return i.IndexItems([]*hnapi.Item{{Id: id, IsDeleted: true}})
+}
+
+/*
+IndexItems adds or updates the items in one write, the deleted items are removed. The last
+version of an item given twice wins.
+*/
+func (i *Index) IndexItems(items []*hnapi.Item) error {
+	latest := make(map[int]*hnapi.Item, len(items))
+	for _, item := range items {
+		latest[item.Id] = item
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	// the stats are only updated once the batch is written, to stay in line with the store
+	stats := i.stats
+	set := make(map[string][]byte)
+	deleted := make([]string, 0)
+	for id, item := range latest {
+		previous, err := i.loadDocument(id)
+		if err != nil && !errors.Is(err, hnapi.ErrNotCached) {
+			return err
+		}
+		if previous == nil && item.IsDeleted {
+			continue
+		}
+		doc := &document{}
+		if !item.IsDeleted {
+			doc = newDocument(item)
+		}
+		if previous != nil {
+			for term := range previous.Terms {
+				if _, ok := doc.Terms[term]; !ok {
+					deleted = append(deleted, postingKey(term, id))
+				}
+			}
+			stats.Docs--
+			stats.Length -= int64(previous.Length)
+		}
+		if item.IsDeleted {
+			deleted = append(deleted, documentKey(id))
+			continue
+		}
+		for term, frequency := range doc.Terms {
+			set[postingKey(term, id)] = []byte(strconv.Itoa(frequency))
+		}
+		value, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		set[documentKey(id)] = value
+		stats.Docs++
+		stats.Length += int64(doc.Length)
+	}
+	if len(set) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	if err := i.saveStats(set, stats); err != nil {
+		return err
+	}
+	if err := i.store.WriteBatch(set, deleted); err != nil {
+		return err
+	}
+	i.stats = stats
+	return nil
+}
+
+/*
+Result is a matching item with its relevance, the higher the better
+*/
+type Result struct {
+	Item  *hnapi.Item
+	Score float64
+}
+
+/*
+Search returns the cached items matching the query, the most relevant first. The queries
+with only filters return the matching items the newest first. limit <= 0 means no limit.
+*/
+func (i *Index) Search(query *Query, limit int) ([]Result, error) {
+	terms := slices.Clone(query.Terms)
+	for _, phrase := range query.Phrases {
+		terms = append(terms, phrase...)
+	}
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+
+	i.mutex.Lock()
+	stats := i.stats
+	i.mutex.Unlock()
+
+	// the frequencies of the terms in the candidates, every term must match
+	var candidates map[int]map[string]int
+	for _, term := range terms {
+		postings := make(map[int]map[string]int)
+		err := i.store.Scan(termPrefix(term), func(key string, value []byte) error {
+			id, err := strconv.Atoi(strings.TrimPrefix(key, termPrefix(term)))
+			if err != nil {
+				return nil
+			}
+			if candidates != nil && candidates[id] == nil {
+				return nil
+			}
+			frequency, _ := strconv.Atoi(string(value))
+			frequencies := candidates[id]
+			if frequencies == nil {
+				frequencies = make(map[string]int)
+			}
+			frequencies[term] = frequency
+			postings[id] = frequencies
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		candidates = postings
+		if len(candidates) == 0 {
+			return []Result{}, nil
+		}
+	}
+	if len(terms) == 0 {
+		candidates = make(map[int]map[string]int)
+		err := i.store.Scan(INDEX_KEY_PREFIX+"doc/", func(key string, value []byte) error {
+			if id, err := strconv.Atoi(strings.TrimPrefix(key, INDEX_KEY_PREFIX+"doc/")); err == nil {
+				candidates[id] = nil
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the document frequencies for the idf
+	documentFrequencies := make(map[string]int, len(terms))
+	for _, frequencies := range candidates {
+		for term := range frequencies {
+			documentFrequencies[term]++
+		}
+	}
+
+	type match struct {
+		result Result
+		time   int
+	}
+	matches := make([]match, 0)
+	averageLength := float64(stats.Length) / math.Max(float64(stats.Docs), 1)
+	for id, frequencies := range candidates {
+		doc, err := i.loadDocument(id)
+		if err != nil {
+			continue // removed since the scan
+		}
+		if !query.matchesFilters(doc) {
+			continue
+		}
+		cached, err := i.store.LoadItem(id)
+		if err != nil {
+			continue
+		}
+		if !matchesPhrases(cached.Item, query.Phrases) {
+			continue
+		}
+		score := 0.0
+		for term, frequency := range frequencies {
+			score += bm25(float64(frequency), float64(doc.Length), averageLength, documentFrequencies[term], stats.Docs)
+		}
+		matches = append(matches, match{Result{cached.Item, score}, doc.Time})
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.result.Score != b.result.Score {
+			if a.result.Score > b.result.Score {
+				return -1
+			}
+			return 1
+		}
+		return b.time - a.time
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	results := make([]Result, len(matches))
+	for j, match := range matches {
+		results[j] = match.result
+	}
+	return results, nil
+}
+
+func bm25(frequency float64, length float64, averageLength float64, documentFrequency int, docs int) float64 {
+	idf := math.Log(1 + (float64(docs)-float64(documentFrequency)+0.5)/(float64(documentFrequency)+0.5))
+	return idf * frequency * (BM25_K1 + 1) / (frequency + BM25_K1*(1-BM25_B+BM25_B*length/math.Max(averageLength, 1)))
+}
+
+func (q *Query) matchesFilters(doc *document) bool {
+	itemTime := time.Unix(int64(doc.Time), 0)
+	switch {
+	case q.By != "" && !strings.EqualFold(q.By, doc.By):
+		return false
+	case q.Type != "" && q.Type != doc.Type:
+		return false
+	case q.MinScore >= 0 && doc.Score <= q.MinScore:
+		return false
+	case q.MaxScore >= 0 && doc.Score >= q.MaxScore:
+		return false
+	case !q.After.IsZero() && itemTime.Before(q.After):
+		return false
+	case !q.Before.IsZero() && !itemTime.Before(q.Before):
+		return false
+	}
+	return true
+}
+
+// the phrases must appear word by word in the title or in the text of the item
+func matchesPhrases(item *hnapi.Item, phrases [][]string) bool {
+	if len(phrases) == 0 {
+		return true
+	}
+	fields := [][]string{Tokenize(item.Title), Tokenize(utils.HtmlToText(item.Text))}
+	for _, phrase := range phrases {
+		found := false
+		for _, words := range fields {
+			for start := 0; start+len(phrase) <= len(words) && !found; start++ {
+				found = slices.Equal(words[start:start+len(phrase)], phrase)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
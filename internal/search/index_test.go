@@ -0,0 +1,207 @@
+package search_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/search"
+	"testing"
+	"time"
+)
+
+func cacheItems(t *testing.T, store hnapi.Store, items ...*hnapi.Item) {
+	for _, item := range items {
+		if err := store.SaveItem(&hnapi.CachedItem{Item: item, FetchedAt: time.Now().Unix()}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+}
+
+func searchIds(t *testing.T, index *search.Index, query string) []int {
+	parsed, err := search.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	results, err := index.Search(parsed, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ids := make([]int, len(results))
+	for i, result := range results {
+		ids[i] = result.Item.Id
+	}
+	return ids
+}
+
+func newTestItems() []*hnapi.Item {
+	day := int(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local).Unix())
+	return []*hnapi.Item{
+		{Id: 1, Type: "story", By: "alice", Time: day, Score: 120, Title: "Rust memory safety explained", Url: "https://example.com/rust"},
+		{Id: 2, Type: "story", By: "bob", Time: day + 86400*10, Score: 15, Title: "Why we moved from Rust to Go"},
+		{Id: 3, Type: "comment", By: "carol", Time: day + 86400*20, Parent: 1, Text: "Safety of <i>memory</i> is not the only reason to pick Rust."},
+		{Id: 4, Type: "story", By: "alice", Time: day + 86400*30, Score: 300, Title: "Show HN: A terminal client for Hacker News"},
+	}
+}
+
+func Test_Index_Search(t *testing.T) {
+	store := hnapi.NewMemoryStore()
+	cacheItems(t, store, newTestItems()...)
+	index, err := search.Open(store) // indexes the items already cached
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ids := searchIds(t, index, "rust")
+	if len(ids) != 3 || ids[0] != 1 {
+		t.Errorf("Expected the 3 items about rust with the best match first, got %v", ids)
+	}
+	if ids := searchIds(t, index, "rust memory"); len(ids) != 2 {
+		t.Errorf("Expected the 2 items with both words, got %v", ids)
+	}
+	if ids := searchIds(t, index, `"memory safety"`); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected only item 1 to have the phrase, got %v", ids)
+	}
+	if ids := searchIds(t, index, "rust by:Alice"); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected only the story of alice, got %v", ids)
+	}
+	if ids := searchIds(t, index, "rust type:comment"); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("Expected only the comment, got %v", ids)
+	}
+	if ids := searchIds(t, index, "rust score>100"); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected only the story with more than 100 points, got %v", ids)
+	}
+	if ids := searchIds(t, index, "rust after:2024-03-05"); len(ids) != 2 {
+		t.Errorf("Expected the 2 newer items, got %v", ids)
+	}
+	// only filters, the newest first
+	if ids := searchIds(t, index, "by:alice"); len(ids) != 2 || ids[0] != 4 {
+		t.Errorf("Expected the stories of alice the newest first, got %v", ids)
+	}
+	if ids := searchIds(t, index, "example"); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected the domain of the url to be indexed, got %v", ids)
+	}
+	if ids := searchIds(t, index, "python"); len(ids) != 0 {
+		t.Errorf("Expected no match, got %v", ids)
+	}
+}
+
+func Test_Index_IncrementalUpdates(t *testing.T) {
+	store := hnapi.NewMemoryStore()
+	index, err := search.Open(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	items := newTestItems()
+	for _, item := range items {
+		cacheItems(t, store, item)
+		if err := index.IndexItem(item); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if ids := searchIds(t, index, "terminal"); len(ids) != 1 {
+		t.Errorf("Expected the indexed story, got %v", ids)
+	}
+
+	edited := *items[1]
+	edited.Title = "Why we moved from Go to Zig"
+	cacheItems(t, store, &edited)
+	index.IndexItem(&edited)
+	if ids := searchIds(t, index, "rust"); len(ids) != 2 {
+		t.Errorf("Expected the edited title to replace the old one, got %v", ids)
+	}
+	if ids := searchIds(t, index, "zig"); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Expected the new title to be indexed, got %v", ids)
+	}
+
+	index.RemoveItem(1)
+	if ids := searchIds(t, index, "rust"); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("Expected the removed item not to match, got %v", ids)
+	}
+	deleted := &hnapi.Item{Id: 3, IsDeleted: true}
+	index.IndexItem(deleted)
+	if ids := searchIds(t, index, "rust"); len(ids) != 0 {
+		t.Errorf("Expected the deleted comment to be removed, got %v", ids)
+	}
+
+	// the index is kept in the store
+	reopened, err := search.Open(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := searchIds(t, reopened, "zig"); len(ids) != 1 {
+		t.Errorf("Expected the reopened index to find the item, got %v", ids)
+	}
+}
+
+func Test_Attach_RebuildsInTheBackground(t *testing.T) {
+	store := hnapi.NewMemoryStore()
+	cacheItems(t, store, newTestItems()...)
+	repo := hnapi.NewRepositoryWithStore(nil, &config.Config{}, store)
+	defer repo.Close()
+	index, err := search.Attach(repo)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := index.WaitRebuilt(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := searchIds(t, index, "rust"); len(ids) != 3 {
+		t.Errorf("Expected the cached items to be indexed, got %v", ids)
+	}
+
+	if err := repo.SaveItemToCache(5, &hnapi.Item{Id: 5, Type: "story", Title: "Rust on the desktop"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.FlushIndex()
+	if ids := searchIds(t, index, "desktop"); len(ids) != 1 || ids[0] != 5 {
+		t.Errorf("Expected the saved item to be indexed, got %v", ids)
+	}
+}
+
+// fails the writes once failing is set
+type failingStore struct {
+	hnapi.Store
+	failing bool
+}
+
+func (s *failingStore) WriteBatch(set map[string][]byte, deleted []string) error {
+	if s.failing {
+		return errors.New("disk full")
+	}
+	return s.Store.WriteBatch(set, deleted)
+}
+
+func Test_Index_StatsUnchangedOnFailedWrite(t *testing.T) {
+	store := &failingStore{Store: hnapi.NewMemoryStore()}
+	items := newTestItems()
+	cacheItems(t, store, items[:2]...)
+	index, err := search.Open(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.failing = true
+	if err := index.IndexItem(items[3]); err == nil {
+		t.Fatalf("Expected the write to fail")
+	}
+	if err := index.RemoveItem(1); err == nil {
+		t.Fatalf("Expected the write to fail")
+	}
+	store.failing = false
+
+	// the stats are saved with the next write, they must still count the 2 indexed items
+	if err := index.IndexItem(items[2]); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	value, err := store.LoadMeta(search.INDEX_STATS_KEY)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var stats struct {
+		Docs int `json:"docs"`
+	}
+	if err := json.Unmarshal(value, &stats); err != nil || stats.Docs != 3 {
+		t.Errorf("Expected 3 indexed items, got %d (%v)", stats.Docs, err)
+	}
+}
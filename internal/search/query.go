@@ -0,0 +1,154 @@
+package search
+
+import (
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const DATE_FORMAT = "2006-01-02"
+
+// the tags of the Algolia search for the types that are not item types, the others are their own tag
+var typeTags = map[string]string{"ask": hnapi.TAG_ASK_HN, "show": hnapi.TAG_SHOW_HN}
+
+/*
+Query is a parsed search query. The words and the phrases must all match, the filters
+narrow the matches down by the author, the type, the score and the time of the items.
+*/
+type Query struct {
+	Terms    []string
+	Phrases  [][]string
+	By       string
+	Type     string
+	MinScore int // exclusive, -1 if not set
+	MaxScore int // exclusive, -1 if not set
+	After    time.Time
+	Before   time.Time
+}
+
+// HasText returns true if the query has words or phrases to match, not only filters
+func (q *Query) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0
+}
+
+/*
+SearchRequest converts the query to a request of the Algolia search, the filters become tags and
+numeric filters. The queries with only filters list the newest items first.
+*/
+func (q *Query) SearchRequest() hnapi.SearchRequest {
+	words := slices.Clone(q.Terms)
+	for _, phrase := range q.Phrases {
+		words = append(words, "\""+strings.Join(phrase, " ")+"\"")
+	}
+	request := hnapi.SearchRequest{Query: strings.Join(words, " "), ByDate: !q.HasText()}
+	if tag, ok := typeTags[q.Type]; ok {
+		request.Tags = append(request.Tags, tag)
+	} else if q.Type != "" {
+		request.Tags = append(request.Tags, q.Type)
+	}
+	if q.By != "" {
+		request.Tags = append(request.Tags, hnapi.AuthorTag(q.By))
+	}
+	if q.MinScore >= 0 {
+		request.NumericFilters = append(request.NumericFilters, fmt.Sprintf("points>%d", q.MinScore))
+	}
+	if q.MaxScore >= 0 {
+		request.NumericFilters = append(request.NumericFilters, fmt.Sprintf("points<%d", q.MaxScore))
+	}
+	if !q.After.IsZero() {
+		request.NumericFilters = append(request.NumericFilters, fmt.Sprintf("created_at_i>=%d", q.After.Unix()))
+	}
+	if !q.Before.IsZero() {
+		request.NumericFilters = append(request.NumericFilters, fmt.Sprintf("created_at_i<%d", q.Before.Unix()))
+	}
+	return request
+}
+
+/*
+ParseQuery parses the words, the "quoted phrases" and the by:name, type:story|comment|...,
+score>N, score<N, after:YYYY-MM-DD and before:YYYY-MM-DD filters of the query
+*/
+func ParseQuery(query string) (*Query, error) {
+	parsed := &Query{MinScore: -1, MaxScore: -1}
+	for _, field := range splitQuery(query) {
+		if strings.HasPrefix(field, "\"") {
+			phrase := Tokenize(strings.Trim(field, "\""))
+			if len(phrase) == 1 {
+				parsed.Terms = append(parsed.Terms, phrase[0])
+			} else if len(phrase) > 1 {
+				parsed.Phrases = append(parsed.Phrases, phrase)
+			}
+			continue
+		}
+		lower := strings.ToLower(field)
+		var err error
+		switch {
+		case strings.HasPrefix(lower, "by:"):
+			parsed.By = strings.TrimPrefix(field, "by:")
+		case strings.HasPrefix(lower, "type:"):
+			parsed.Type = strings.TrimPrefix(lower, "type:")
+		case strings.HasPrefix(lower, "score>"):
+			parsed.MinScore, err = strconv.Atoi(strings.TrimPrefix(lower, "score>"))
+		case strings.HasPrefix(lower, "score<"):
+			parsed.MaxScore, err = strconv.Atoi(strings.TrimPrefix(lower, "score<"))
+		case strings.HasPrefix(lower, "after:"):
+			parsed.After, err = time.ParseInLocation(DATE_FORMAT, strings.TrimPrefix(lower, "after:"), time.Local)
+		case strings.HasPrefix(lower, "before:"):
+			parsed.Before, err = time.ParseInLocation(DATE_FORMAT, strings.TrimPrefix(lower, "before:"), time.Local)
+		default:
+			parsed.Terms = append(parsed.Terms, Tokenize(field)...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter \"%s\": %w", field, err)
+		}
+	}
+	return parsed, nil
+}
+
+// splits the query by the spaces outside of the quotes, the phrases keep their quotes
+func splitQuery(query string) []string {
+	fields := make([]string, 0)
+	current := strings.Builder{}
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			if quoted {
+				current.WriteRune(r)
+				fields = append(fields, current.String())
+				current.Reset()
+			} else {
+				if current.Len() > 0 {
+					fields = append(fields, current.String())
+					current.Reset()
+				}
+				current.WriteRune(r)
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+/*
+Tokenize splits the text into lower case words of letters and digits
+*/
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,66 @@
+package search_test
+
+import (
+	"hnterminal/internal/search"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_Tokenize(t *testing.T) {
+	words := search.Tokenize("Show HN: Go 1.25's new GC, 40% faster!")
+	expected := []string{"show", "hn", "go", "1", "25", "s", "new", "gc", "40", "faster"}
+	if !slices.Equal(words, expected) {
+		t.Errorf("Expected %v, got %v", expected, words)
+	}
+}
+
+func Test_ParseQuery(t *testing.T) {
+	query, err := search.ParseQuery(`rust "Memory Safety" by:pg type:Story score>10 score<500 after:2024-01-31`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !slices.Equal(query.Terms, []string{"rust"}) {
+		t.Errorf("Expected the terms [rust], got %v", query.Terms)
+	}
+	if len(query.Phrases) != 1 || !slices.Equal(query.Phrases[0], []string{"memory", "safety"}) {
+		t.Errorf("Expected the phrase [memory safety], got %v", query.Phrases)
+	}
+	if query.By != "pg" || query.Type != "story" || query.MinScore != 10 || query.MaxScore != 500 {
+		t.Errorf("Expected the filters by:pg type:story score>10 score<500, got %+v", query)
+	}
+	if expected := time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local); !query.After.Equal(expected) || !query.Before.IsZero() {
+		t.Errorf("Expected to match after %v, got %v and before %v", expected, query.After, query.Before)
+	}
+	if !query.HasText() {
+		t.Errorf("Expected the query to have text")
+	}
+
+	if _, err := search.ParseQuery("score>many"); err == nil {
+		t.Errorf("Expected an error for an invalid score")
+	}
+	if _, err := search.ParseQuery("after:yesterday"); err == nil {
+		t.Errorf("Expected an error for an invalid date")
+	}
+}
+
+func Test_Query_SearchRequest(t *testing.T) {
+	query, _ := search.ParseQuery(`rust "memory safety" by:pg type:comment score>10`)
+	request := query.SearchRequest()
+	if request.Query != `rust "memory safety"` || request.ByDate {
+		t.Errorf("Expected the words and the quoted phrase sorted by relevance, got \"%s\", %v", request.Query, request.ByDate)
+	}
+	if !slices.Equal(request.Tags, []string{"comment", "author_pg"}) || !slices.Equal(request.NumericFilters, []string{"points>10"}) {
+		t.Errorf("Expected the filters as tags and numeric filters, got %v and %v", request.Tags, request.NumericFilters)
+	}
+	query, _ = search.ParseQuery("by:pg")
+	if request := query.SearchRequest(); !request.ByDate {
+		t.Errorf("Expected a query with only filters to be sorted by date")
+	}
+	for queryType, tag := range map[string]string{"ask": "ask_hn", "show": "show_hn", "story": "story", "job": "job"} {
+		query, _ = search.ParseQuery("type:" + queryType)
+		if request := query.SearchRequest(); !slices.Equal(request.Tags, []string{tag}) {
+			t.Errorf("Expected type:%s to be the tag %s, got %v", queryType, tag, request.Tags)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/search"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how long the clients may reuse the responses that never change, e.g. the old or deleted items
+const IMMUTABLE_MAX_AGE = time.Hour * 24 * 365
+
+// how long the clients may reuse a feed, counted from the time it was fetched at
+const FEED_MAX_AGE = time.Minute
+
+const USER_MAX_AGE = time.Minute * 5
+
+// how long the clients may reuse the null of an unknown item or user, the next items are unknown until posted
+const NOT_FOUND_MAX_AGE = time.Second * 30
+
+const DEFAULT_STORY_COUNT = 30
+const MAX_STORY_COUNT = 500
+const DEFAULT_SEARCH_LIMIT = 30
+const MAX_SEARCH_LIMIT = 200
+
+/*
+Server serves the cache of a repository over HTTP. The paths of the Hacker News API are
+mirrored under /v0/ so its clients only need another base url, the max item and the updates
+are not cached and always come from the API. The enriched endpoints under /api/ return whole
+comment trees, stories and local search results in one response.
+*/
+type Server struct {
+	repo  *hnapi.Repository
+	index *search.Index
+	mux   *http.ServeMux
+}
+
+/*
+New returns the server of the repository, index may be nil if the search is not available
+*/
+func New(repo *hnapi.Repository, index *search.Index) *Server {
+	s := &Server{repo: repo, index: index, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /v0/item/{file}", s.handleItem)
+	s.mux.HandleFunc("GET /v0/user/{file}", s.handleUser)
+	s.mux.HandleFunc("GET /v0/maxitem.json", s.handleMaxItem)
+	s.mux.HandleFunc("GET /v0/updates.json", s.handleUpdates)
+	s.mux.HandleFunc("GET /v0/{file}", s.handleFeed)
+	s.mux.HandleFunc("GET /api/comments/{id}", s.handleComments)
+	s.mux.HandleFunc("GET /api/stories/{feed}", s.handleStories)
+	s.mux.HandleFunc("GET /api/search", s.handleSearch)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// CommentTree is a comment tree as served by /api/comments/<id>, the fields of the item are inlined
+type CommentTree struct {
+	*hnapi.Item
+	Depth    int            `json:"depth"`
+	Comments []*CommentTree `json:"comments"`
+}
+
+func newCommentTree(node *hnapi.CommentNode) *CommentTree {
+	tree := &CommentTree{Item: node.Item, Depth: node.Depth, Comments: make([]*CommentTree, len(node.Children))}
+	for i, child := range node.Children {
+		tree.Comments[i] = newCommentTree(child)
+	}
+	return tree
+}
+
+// SearchResult is a result of /api/search
+type SearchResult struct {
+	Score float64     `json:"score"`
+	Item  *hnapi.Item `json:"item"`
+}
+
+// strips the extension of the firebase paths like "8863.json"
+func trimJSON(file string) (string, bool) {
+	name, ok := strings.CutSuffix(file, ".json")
+	return name, ok && name != ""
+}
+
+func (s *Server) handleItem(w http.ResponseWriter, r *http.Request) {
+	name, ok := trimJSON(r.PathValue("file"))
+	id, err := strconv.Atoi(name)
+	if !ok || err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid item id \"%s\"", r.PathValue("file")))
+		return
+	}
+	item, err := s.repo.GetItem(r.Context(), id)
+	if errors.Is(err, hnapi.ErrNotFound) { // the API responds with null for unknown items
+		writeJSON(w, NOT_FOUND_MAX_AGE, nil)
+		return
+	}
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	writeJSON(w, s.itemMaxAge(id, time.Now()), item)
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := trimJSON(r.PathValue("file"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid user id \"%s\"", r.PathValue("file")))
+		return
+	}
+	user, err := s.repo.GetUser(r.Context(), id)
+	if errors.Is(err, hnapi.ErrNotFound) {
+		writeJSON(w, NOT_FOUND_MAX_AGE, nil)
+		return
+	}
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	writeJSON(w, USER_MAX_AGE, user)
+}
+
+func (s *Server) handleMaxItem(w http.ResponseWriter, r *http.Request) {
+	maxItem, err := s.repo.GetMaxItem(r.Context())
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	writeJSON(w, 0, maxItem)
+}
+
+func (s *Server) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	updates, err := s.repo.GetUpdates(r.Context())
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	writeJSON(w, 0, updates)
+}
+
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	name, ok := trimJSON(r.PathValue("file"))
+	if !ok || !strings.HasSuffix(name, "stories") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path \"%s\"", r.URL.Path))
+		return
+	}
+	feed, err := hnapi.ParseFeed(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	cachedFeed, err := s.repo.GetFeed(r.Context(), feed)
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	writeJSON(w, feedMaxAge(cachedFeed, time.Now()), cachedFeed.Ids)
+}
+
+/*
+handleComments serves the item with its comments nested under "comments" up to the
+depth query parameter (0 or missing means no limit). The comments that could not be
+loaded are left out.
+*/
+func (s *Server) handleComments(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid item id \"%s\"", r.PathValue("id")))
+		return
+	}
+	depth, err := intParameter(r, "depth", 0, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	node, err := s.repo.GetCommentTree(r.Context(), id, depth)
+	if node == nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	if err != nil {
+		log.Printf("some comments of %d could not be loaded: %v", id, err)
+	}
+	writeJSON(w, s.treeMaxAge(node, time.Now()), newCommentTree(node))
+}
+
+// handleStories serves the first count items of the feed
+func (s *Server) handleStories(w http.ResponseWriter, r *http.Request) {
+	feed, err := hnapi.ParseFeed(r.PathValue("feed"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	count, err := intParameter(r, "count", DEFAULT_STORY_COUNT, MAX_STORY_COUNT)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cachedFeed, err := s.repo.GetFeed(r.Context(), feed)
+	if err != nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	ids := cachedFeed.Ids[:min(len(cachedFeed.Ids), count)]
+	items, err := s.repo.GetItems(r.Context(), ids)
+	if items == nil {
+		s.writeRepositoryError(w, r, err)
+		return
+	}
+	if err != nil {
+		log.Printf("some %s stories could not be loaded: %v", feed, err)
+	}
+	stories := make([]*hnapi.Item, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			stories = append(stories, item)
+		}
+	}
+	writeJSON(w, feedMaxAge(cachedFeed, time.Now()), stories)
+}
+
+// handleSearch serves the results of the q query parameter in the local index, see search.ParseQuery
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.index == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("the search index is not available"))
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing query parameter q"))
+		return
+	}
+	query, err := search.ParseQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := intParameter(r, "limit", DEFAULT_SEARCH_LIMIT, MAX_SEARCH_LIMIT)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	results, err := s.index.Search(query, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	served := make([]SearchResult, len(results))
+	for i, result := range results {
+		served[i] = SearchResult{result.Score, result.Item}
+	}
+	writeJSON(w, 0, served)
+}
+
+/*
+itemMaxAge returns how long the cached copy of the item stays fresh for the freshness policy
+of the repository, the copies that are never refetched are immutable
+*/
+func (s *Server) itemMaxAge(id int, now time.Time) time.Duration {
+	cached, err := s.repo.LoadItemFromCache(id)
+	if err != nil {
+		return 0
+	}
+	policy := s.repo.FreshnessPolicy()
+	if policy == nil || cached.Item.IsDeleted {
+		return IMMUTABLE_MAX_AGE
+	}
+	ttl, immutable := policy.TTL(cached.Item, now)
+	if immutable {
+		return IMMUTABLE_MAX_AGE
+	}
+	return max(ttl-now.Sub(cached.FetchedTime()), 0)
+}
+
+// the tree is as fresh as its least fresh item
+func (s *Server) treeMaxAge(node *hnapi.CommentNode, now time.Time) time.Duration {
+	maxAge := s.itemMaxAge(node.Item.Id, now)
+	for _, child := range node.Children {
+		maxAge = min(maxAge, s.treeMaxAge(child, now))
+	}
+	return maxAge
+}
+
+func feedMaxAge(cachedFeed *hnapi.CachedFeed, now time.Time) time.Duration {
+	return max(FEED_MAX_AGE-now.Sub(cachedFeed.FetchedTime()), 0)
+}
+
+// reads a positive integer parameter, values above maxValue are capped unless maxValue is 0
+func intParameter(r *http.Request, name string, defaultValue int, maxValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s \"%s\"", name, value)
+	}
+	if maxValue > 0 {
+		parsed = min(parsed, maxValue)
+	}
+	return parsed, nil
+}
+
+/*
+writeRepositoryError maps the errors of the repository to the status codes, the data that
+is not cached while offline is unavailable and the other failures come from the upstream API
+*/
+func (s *Server) writeRepositoryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil: // the client went away
+		return
+	case errors.Is(err, hnapi.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, hnapi.ErrNotCached):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		log.Printf("error while serving %s: %v", r.URL.Path, err)
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+// writes the value as JSON, a maxAge of 0 makes the clients revalidate the response every time
+func writeJSON(w http.ResponseWriter, maxAge time.Duration, value any) {
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("error while writing the response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,212 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"hnterminal/internal/search"
+	"hnterminal/internal/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *hnapi.Repository, *hntest.Server) {
+	upstream := hntest.NewServerWithFixtures()
+	t.Cleanup(upstream.Close)
+	api := hnapi.NewApiClient(nil, upstream.BaseUrl())
+	api.SetRetryPolicy(hnapi.RetryPolicy{MaxAttempts: 1})
+	repo, err := hnapi.NewRepository(api, &config.Config{DbPath: t.TempDir(), BaseUrl: upstream.BaseUrl()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(repo.Close)
+	index, err := search.Attach(repo)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	s := httptest.NewServer(server.New(repo, index))
+	t.Cleanup(s.Close)
+	return s, repo, upstream
+}
+
+func get(t *testing.T, url string, value any) *http.Response {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer response.Body.Close()
+	if value != nil {
+		if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+			t.Fatalf("Expected a JSON body, got %v", err)
+		}
+	}
+	return response
+}
+
+func Test_Server_Item(t *testing.T) {
+	s, _, upstream := newTestServer(t)
+	for range 2 {
+		var item hnapi.Item
+		response := get(t, s.URL+"/v0/item/100.json", &item)
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", response.StatusCode)
+		}
+		if item.Title != "Show HN: A terminal reader for Hacker News" {
+			t.Errorf("Unexpected title \"%s\"", item.Title)
+		}
+		expected := fmt.Sprintf("public, max-age=%d", int(server.IMMUTABLE_MAX_AGE.Seconds()))
+		if cacheControl := response.Header.Get("Cache-Control"); cacheControl != expected {
+			t.Errorf("Expected the old item to be immutable, got \"%s\"", cacheControl)
+		}
+	}
+	if count := upstream.RequestCount("item/100.json"); count != 1 {
+		t.Errorf("Expected the item to be fetched once, got %d requests", count)
+	}
+}
+
+func Test_Server_ItemMaxAgeFollowsFreshness(t *testing.T) {
+	s, _, upstream := newTestServer(t)
+	upstream.AddItems(hnapi.Item{Id: 500, Type: "story", By: "dave", Time: int(time.Now().Unix()), Title: "Fresh story"})
+	response := get(t, s.URL+"/v0/item/500.json", nil)
+	cacheControl := response.Header.Get("Cache-Control")
+	var maxAge int
+	if _, err := fmt.Sscanf(cacheControl, "public, max-age=%d", &maxAge); err != nil {
+		t.Fatalf("Expected a max-age, got \"%s\"", cacheControl)
+	}
+	if maxAge <= 0 || maxAge > 60 {
+		t.Errorf("Expected the TTL of the recent items (1 minute), got %d", maxAge)
+	}
+}
+
+func Test_Server_UnknownItemIsNull(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	response, err := http.Get(s.URL + "/v0/item/12345.json")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "null" {
+		t.Errorf("Expected 200 null like the API, got %d %s", response.StatusCode, body)
+	}
+	expected := fmt.Sprintf("public, max-age=%d", int(server.NOT_FOUND_MAX_AGE.Seconds()))
+	if cacheControl := response.Header.Get("Cache-Control"); cacheControl != expected {
+		t.Errorf("Expected the not found max-age, got \"%s\"", cacheControl)
+	}
+}
+
+func Test_Server_MaxItemAndUpdates(t *testing.T) {
+	s, repo, upstream := newTestServer(t)
+	var maxItem int
+	get(t, s.URL+"/v0/maxitem.json", &maxItem)
+	if maxItem != 400 {
+		t.Errorf("Expected the max item of the API, got %d", maxItem)
+	}
+	var updates hnapi.Updates
+	response := get(t, s.URL+"/v0/updates.json", &updates)
+	if fmt.Sprint(updates.Items) != "[100 200]" || fmt.Sprint(updates.Profiles) != "[alice]" {
+		t.Errorf("Expected the updates of the API, got %+v", updates)
+	}
+	if cacheControl := response.Header.Get("Cache-Control"); cacheControl != "no-cache" {
+		t.Errorf("Expected the updates not to be cached, got \"%s\"", cacheControl)
+	}
+
+	repo.SetOffline(true)
+	if response := get(t, s.URL+"/v0/maxitem.json", nil); response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 offline, got %d", response.StatusCode)
+	}
+	if count := upstream.RequestCount("maxitem.json"); count != 1 {
+		t.Errorf("Expected the max item to be fetched once, got %d requests", count)
+	}
+}
+
+func Test_Server_FeedAndUser(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	var ids []int
+	response := get(t, s.URL+"/v0/beststories.json", &ids)
+	if fmt.Sprint(ids) != "[200 100]" {
+		t.Errorf("Expected the best stories, got %v", ids)
+	}
+	if cacheControl := response.Header.Get("Cache-Control"); !strings.HasPrefix(cacheControl, "public, max-age=") {
+		t.Errorf("Expected the feed to be cacheable, got \"%s\"", cacheControl)
+	}
+	var user hnapi.User
+	get(t, s.URL+"/v0/user/alice.json", &user)
+	if user.Karma != 4321 {
+		t.Errorf("Expected the karma of alice, got %d", user.Karma)
+	}
+	if response := get(t, s.URL+"/v0/unknown.json", nil); response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown path, got %d", response.StatusCode)
+	}
+}
+
+func Test_Server_Comments(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	var tree server.CommentTree
+	get(t, s.URL+"/api/comments/100", &tree)
+	if tree.Item == nil || tree.Id != 100 || len(tree.Comments) != 2 {
+		t.Fatalf("Expected the story with its 2 comments, got %+v", tree)
+	}
+	if replies := tree.Comments[0].Comments; len(replies) != 2 || replies[0].By != "alice" || replies[0].Depth != 2 {
+		t.Errorf("Expected the nested replies of the first comment, got %+v", replies)
+	}
+
+	tree = server.CommentTree{}
+	get(t, s.URL+"/api/comments/100?depth=1", &tree)
+	if len(tree.Comments) != 2 || len(tree.Comments[0].Comments) != 0 {
+		t.Errorf("Expected only the top level comments, got %+v", tree.Comments)
+	}
+	if response := get(t, s.URL+"/api/comments/100?depth=x", nil); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid depth, got %d", response.StatusCode)
+	}
+}
+
+func Test_Server_StoriesAndSearch(t *testing.T) {
+	s, repo, _ := newTestServer(t)
+	var stories []hnapi.Item
+	get(t, s.URL+"/api/stories/top?count=2", &stories)
+	if len(stories) != 2 || stories[0].Id != 100 || stories[1].Id != 200 {
+		t.Fatalf("Expected the first 2 top stories, got %+v", stories)
+	}
+	repo.FlushIndex()
+
+	var results []server.SearchResult
+	get(t, s.URL+"/api/search?q=terminal", &results)
+	if len(results) != 1 || results[0].Item.Id != 100 {
+		t.Errorf("Expected the cached story about terminals, got %+v", results)
+	}
+	if response := get(t, s.URL+"/api/search", nil); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a query, got %d", response.StatusCode)
+	}
+}
+
+func Test_Server_OfflineNotCached(t *testing.T) {
+	s, repo, _ := newTestServer(t)
+	repo.SetOffline(true)
+	var body map[string]string
+	response := get(t, s.URL+"/v0/item/200.json", &body)
+	if response.StatusCode != http.StatusServiceUnavailable || body["error"] == "" {
+		t.Errorf("Expected status 503 with an error, got %d %v", response.StatusCode, body)
+	}
+}
+
+func Test_Server_MethodNotAllowed(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	response, err := http.Post(s.URL+"/v0/item/100.json", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", response.StatusCode)
+	}
+}
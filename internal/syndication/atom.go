@@ -0,0 +1,74 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"hnterminal/internal/hnapi"
+	"time"
+)
+
+const ATOM_NAMESPACE = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Id        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Id        string     `xml:"id"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    atomAuthor `xml:"author"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func newAtomFeed(channel Channel, items []*hnapi.Item) *atomFeed {
+	feed := &atomFeed{
+		Namespace: ATOM_NAMESPACE,
+		Title:     channel.Title,
+		Subtitle:  channel.Description,
+		Id:        channel.Link,
+		Updated:   channel.Updated.UTC().Format(time.RFC3339),
+		Link:      atomLink{"alternate", channel.Link},
+		Generator: GENERATOR,
+		Entries:   make([]atomEntry, 0, len(items)),
+	}
+	for _, item := range items {
+		links := []atomLink{{"alternate", itemLink(item)}}
+		if item.Url != "" {
+			links = append(links, atomLink{"replies", ItemUrl(item)})
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     itemTitle(item),
+			Id:        ItemUrl(item),
+			Links:     links,
+			Published: itemTime(item).Format(time.RFC3339),
+			Updated:   itemTime(item).Format(time.RFC3339),
+			Author:    atomAuthor{item.By},
+			Content:   atomText{"html", itemContent(item)},
+		})
+	}
+	return feed
+}
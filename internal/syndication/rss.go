@@ -0,0 +1,66 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"hnterminal/internal/hnapi"
+	"time"
+)
+
+// the RSS 2.0 document, the authors are in the dc:creator element as RSS wants emails
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Guid        rssGuid `xml:"guid"`
+	Comments    string  `xml:"comments"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func newRSS(channel Channel, items []*hnapi.Item) *rss {
+	document := &rss{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         channel.Title,
+			Link:          channel.Link,
+			Description:   channel.Description,
+			LastBuildDate: channel.Updated.UTC().Format(time.RFC1123Z),
+			Generator:     GENERATOR,
+			Items:         make([]rssItem, 0, len(items)),
+		},
+	}
+	for _, item := range items {
+		document.Channel.Items = append(document.Channel.Items, rssItem{
+			Title:       itemTitle(item),
+			Link:        itemLink(item),
+			Guid:        rssGuid{true, ItemUrl(item)},
+			Comments:    ItemUrl(item),
+			PubDate:     itemTime(item).Format(time.RFC1123Z),
+			Creator:     item.By,
+			Description: itemContent(item),
+		})
+	}
+	return document
+}
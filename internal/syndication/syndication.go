@@ -0,0 +1,181 @@
+/*
+Package syndication renders lists of Hacker News items as RSS 2.0 or Atom feeds
+*/
+package syndication
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/richtext"
+	"hnterminal/internal/utils"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatRSS  Format = "rss"
+	FormatAtom Format = "atom"
+)
+
+const GENERATOR = "hacker-news-terminal"
+
+// ParseFormat returns the format for a name like "rss" or "atom"
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatRSS, FormatAtom:
+		return format, nil
+	}
+	return FormatRSS, fmt.Errorf("unknown feed format \"%s\", expected rss or atom", name)
+}
+
+/*
+Channel describes the feed, Link is the page the feed is about
+*/
+type Channel struct {
+	Title       string
+	Link        string
+	Description string
+	Updated     time.Time
+}
+
+/*
+Filter selects the items of a feed. The items need at least MinScore points, a link to one
+of the Domains (or to their subdomains) and one of the Keywords in their title or text,
+the empty filters match every item. The deleted and dead items never match.
+*/
+type Filter struct {
+	MinScore int
+	Domains  []string
+	Keywords []string
+}
+
+func (f Filter) Match(item *hnapi.Item) bool {
+	if item == nil || item.IsDeleted || item.IsDead || item.Score < f.MinScore {
+		return false
+	}
+	if len(f.Domains) > 0 && !hnapi.MatchesDomain(item.Url, f.Domains...) {
+		return false
+	}
+	if len(f.Keywords) > 0 {
+		text := strings.ToLower(item.Title + " " + richtext.Parse(item.Text).PlainText())
+		for _, keyword := range f.Keywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Apply returns the matching items in the same order
+func (f Filter) Apply(items []*hnapi.Item) []*hnapi.Item {
+	matching := make([]*hnapi.Item, 0, len(items))
+	for _, item := range items {
+		if f.Match(item) {
+			matching = append(matching, item)
+		}
+	}
+	return matching
+}
+
+// String describes the filter, e.g. "min score 100, keywords: go, rust"
+func (f Filter) String() string {
+	parts := make([]string, 0, 3)
+	if f.MinScore > 0 {
+		parts = append(parts, fmt.Sprintf("min score %d", f.MinScore))
+	}
+	if len(f.Domains) > 0 {
+		parts = append(parts, "domains: "+strings.Join(f.Domains, ", "))
+	}
+	if len(f.Keywords) > 0 {
+		parts = append(parts, "keywords: "+strings.Join(f.Keywords, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+/*
+Write renders the items as a feed of the format, the items are expected to be filtered already
+*/
+func Write(w io.Writer, format Format, channel Channel, items []*hnapi.Item) error {
+	if channel.Updated.IsZero() {
+		channel.Updated = time.Now()
+	}
+	var document any
+	switch format {
+	case FormatAtom:
+		document = newAtomFeed(channel, items)
+	default:
+		document = newRSS(channel, items)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+var feedPages = map[hnapi.Feed]string{
+	hnapi.FeedTop:  "news",
+	hnapi.FeedNew:  "newest",
+	hnapi.FeedBest: "best",
+	hnapi.FeedAsk:  "ask",
+	hnapi.FeedShow: "show",
+	hnapi.FeedJob:  "jobs",
+}
+
+// FeedUrl returns the page of the feed on Hacker News
+func FeedUrl(feed hnapi.Feed) string {
+	return hnapi.HN_URL + feedPages[feed]
+}
+
+// ItemUrl returns the discussion page of the item on Hacker News
+func ItemUrl(item *hnapi.Item) string {
+	return hnapi.HN_ITEM_URL + strconv.Itoa(item.Id)
+}
+
+// the title of an item, the start of the text for the comments
+func itemTitle(item *hnapi.Item) string {
+	if item.Title != "" {
+		return item.Title
+	}
+	text := strings.Join(strings.Fields(richtext.Parse(item.Text).PlainText()), " ")
+	return fmt.Sprintf("Comment by %s: %s", item.By, utils.Truncate(text, 80))
+}
+
+// the link of an item, its discussion if it has no url
+func itemLink(item *hnapi.Item) string {
+	if item.Url != "" {
+		return item.Url
+	}
+	return ItemUrl(item)
+}
+
+// the HTML content of an item: its text and a line with its score and a link to its comments
+func itemContent(item *hnapi.Item) string {
+	var content strings.Builder
+	if item.Text != "" {
+		content.WriteString("<p>" + item.Text + "</p>\n")
+	}
+	details := fmt.Sprintf("%d points by %s", item.Score, html.EscapeString(item.By))
+	if item.Type == "comment" {
+		details = "by " + html.EscapeString(item.By)
+	}
+	fmt.Fprintf(&content, "<p>%s | <a href=\"%s\">%d comments</a></p>", details, ItemUrl(item), item.CommentsCount)
+	return content.String()
+}
+
+func itemTime(item *hnapi.Item) time.Time {
+	return time.Unix(int64(item.Time), 0).UTC()
+}
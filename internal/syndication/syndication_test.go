@@ -0,0 +1,121 @@
+package syndication_test
+
+import (
+	"encoding/xml"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/syndication"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestItems() []*hnapi.Item {
+	return []*hnapi.Item{
+		{Id: 1, Type: "story", By: "alice", Time: 1700000000, Score: 120, Title: "Rust in the kernel", Url: "https://www.lwn.net/articles/1", CommentsCount: 42},
+		{Id: 2, Type: "story", By: "bob", Time: 1700003600, Score: 15, Title: "Ask HN: Go or Rust?", Text: "Which one &amp; why?"},
+		{Id: 3, Type: "story", By: "carol", Time: 1700007200, Score: 300, Title: "Go 1.25 released", Url: "https://go.dev/blog/go1.25"},
+		{Id: 4, Type: "story", Time: 1700010800, IsDeleted: true},
+		nil, // an item that could not be loaded
+	}
+}
+
+func filteredIds(filter syndication.Filter) []int {
+	ids := make([]int, 0)
+	for _, item := range filter.Apply(newTestItems()) {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+func Test_Filter(t *testing.T) {
+	if ids := filteredIds(syndication.Filter{}); len(ids) != 3 {
+		t.Errorf("Expected the 3 stories that are not deleted, got %v", ids)
+	}
+	if ids := filteredIds(syndication.Filter{MinScore: 100}); len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("Expected the 2 stories with at least 100 points, got %v", ids)
+	}
+	if ids := filteredIds(syndication.Filter{Domains: []string{"lwn.net"}}); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected the story of lwn.net, got %v", ids)
+	}
+	if ids := filteredIds(syndication.Filter{Domains: []string{"o.dev"}}); len(ids) != 0 {
+		t.Errorf("Expected the domain to match whole labels, got %v", ids)
+	}
+	if ids := filteredIds(syndication.Filter{Keywords: []string{"RUST"}}); len(ids) != 2 {
+		t.Errorf("Expected the 2 stories about rust, got %v", ids)
+	}
+	if ids := filteredIds(syndication.Filter{Keywords: []string{"why", "kernel"}, MinScore: 100}); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("Expected every filter to apply, got %v", ids)
+	}
+}
+
+func Test_Write_RSS(t *testing.T) {
+	var out strings.Builder
+	channel := syndication.Channel{Title: "Hacker News: top stories", Link: "https://news.ycombinator.com/news", Updated: time.Unix(1700010000, 0)}
+	items := syndication.Filter{}.Apply(newTestItems())
+	if err := syndication.Write(&out, syndication.FormatRSS, channel, items); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var document struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Guid        string `xml:"guid"`
+				PubDate     string `xml:"pubDate"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(out.String()), &document); err != nil {
+		t.Fatalf("Expected valid XML, got %v:\n%s", err, out.String())
+	}
+	if document.Version != "2.0" || document.Channel.Title != channel.Title || len(document.Channel.Items) != 3 {
+		t.Fatalf("Expected an RSS 2.0 channel with 3 items, got %+v", document)
+	}
+	first, second := document.Channel.Items[0], document.Channel.Items[1]
+	if first.Link != "https://www.lwn.net/articles/1" || first.Guid != "https://news.ycombinator.com/item?id=1" || first.PubDate != "Tue, 14 Nov 2023 22:13:20 +0000" {
+		t.Errorf("Expected the link, guid and date of the story, got %+v", first)
+	}
+	if second.Link != "https://news.ycombinator.com/item?id=2" || !strings.Contains(second.Description, "Which one &amp; why?") {
+		t.Errorf("Expected the ask HN story to link to its discussion with its text, got %+v", second)
+	}
+}
+
+func Test_Write_Atom(t *testing.T) {
+	var out strings.Builder
+	channel := syndication.Channel{Title: "Saved", Link: "https://news.ycombinator.com/"}
+	items := syndication.Filter{}.Apply(newTestItems())
+	if err := syndication.Write(&out, syndication.FormatAtom, channel, items); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var feed struct {
+		XMLName xml.Name
+		Entries []struct {
+			Id      string `xml:"id"`
+			Updated string `xml:"updated"`
+			Author  string `xml:"author>name"`
+			Links   []struct {
+				Rel  string `xml:"rel,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal([]byte(out.String()), &feed); err != nil {
+		t.Fatalf("Expected valid XML, got %v:\n%s", err, out.String())
+	}
+	if feed.XMLName.Space != syndication.ATOM_NAMESPACE || feed.XMLName.Local != "feed" || len(feed.Entries) != 3 {
+		t.Fatalf("Expected an Atom feed with 3 entries, got %+v", feed)
+	}
+	entry := feed.Entries[2]
+	if entry.Id != "https://news.ycombinator.com/item?id=3" || entry.Updated != "2023-11-15T00:13:20Z" || entry.Author != "carol" {
+		t.Errorf("Expected the id, date and author of the entry, got %+v", entry)
+	}
+	if len(entry.Links) != 2 || entry.Links[0].Href != "https://go.dev/blog/go1.25" || entry.Links[1].Rel != "replies" {
+		t.Errorf("Expected the links to the story and to its discussion, got %+v", entry.Links)
+	}
+	if _, err := syndication.ParseFormat("json"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
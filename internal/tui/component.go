@@ -132,6 +132,13 @@ func (c *BaseComponent) RemoveChildById(id int) {
 	}
 }
 
+func (c *BaseComponent) RemoveChildren() {
+	for _, child := range c.children {
+		child.SetParent(nil)
+	}
+	c.children = nil
+}
+
 func (c *BaseComponent) Style() tcell.Style {
 	return c.style
 }
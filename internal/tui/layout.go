@@ -4,7 +4,7 @@ import (
 	"hnterminal/internal/utils"
 )
 
-type layoutFunc func(*BaseComponent)
+type layoutFunc func(*BaseComponent) bool
 
 type Layout int
 
@@ -115,7 +115,7 @@ func calculateGrid(percentages []int, targetSize int) []int {
 
 // type horizontalGridLayoutFunc struct{}
 // the height is given by the parent or the biggest height of the children
-func horizontalGridLayoutFunc(component *BaseComponent) {
+func horizontalGridLayoutFunc(component *BaseComponent) bool {
 	children := component.FilteredChildren(func(c *BaseComponent) bool { // filter out floating components
 		return !c.floating
 	})
@@ -153,13 +153,15 @@ func horizontalGridLayoutFunc(component *BaseComponent) {
 		children[i].height = height
 		xOffset += w
 	}
+	return component.height == -1
 }
 
-func verticalGridLayoutFunc(component *BaseComponent) {
+func verticalGridLayoutFunc(component *BaseComponent) bool {
+	return false
 }
 
 // returns true if the component needs follow up
-func fixedWidthLayoutFunc(component *BaseComponent) {
+func fixedWidthLayoutFunc(component *BaseComponent) bool {
 	children := component.FilteredChildren(func(c *BaseComponent) bool { // filter out floating components
 		return !c.floating
 	})
@@ -167,38 +169,52 @@ func fixedWidthLayoutFunc(component *BaseComponent) {
 		c.width = component.width - component.padding.Left - component.padding.Right
 		c.kind.OnUpdate(c)
 	}
+	// stack the children below each other
+	yOffset := 0
+	for _, c := range children {
+		if c.height == -1 {
+			yOffset = -1
+			break
+		}
+		c.x = component.padding.Left
+		c.y = yOffset + component.padding.Top
+		yOffset += c.height
+		c.kind.OnUpdate(c)
+	}
 	if component.height == -1 { // if not set, we try to use the fixedHeight
 		if component.fixedHeight != -1 {
 			component.height = component.fixedHeight + component.padding.Top + component.padding.Bottom
-		} else {
-			// add up the heights of the children
-			yOffset := 0
-			for _, c := range children {
-				if c.height == -1 {
-					yOffset = -1
-					break
-				}
-				c.x = component.padding.Left
-				c.y = yOffset + component.padding.Top
-				yOffset += c.height
-				c.kind.OnUpdate(c)
-			}
-			if yOffset == -1 {
-				component.height = -1
-			} else {
-				component.height = yOffset + component.padding.Top + component.padding.Bottom
-			}
+		} else if yOffset != -1 { // ...otherwise we add up the heights of the children
+			component.height = yOffset + component.padding.Top + component.padding.Bottom
 		}
 	}
+	return component.height == -1 || yOffset == -1
 }
 
-func fixedHeightLayoutFunc(c *BaseComponent) {
+func fixedHeightLayoutFunc(c *BaseComponent) bool {
+	return false
 }
 
 func ApplyLayout(component *BaseComponent) bool {
 	if component.floating {
 		updateFloating(component)
 	}
-	layoutFuncs[component.layout](component)
-	return component.height == -1 || component.width == -1
+	needsFollowUp := layoutFuncs[component.layout](component)
+	return needsFollowUp || component.height == -1 || component.width == -1
+}
+
+/*
+LayoutSubtree lays out the component and its non-floating descendants. The first pass goes down
+the tree, the components whose geometry depends on their children are laid out again going back up.
+*/
+func LayoutSubtree(root *BaseComponent) {
+	layoutStack := make([]*BaseComponent, 0)
+	for c := range root.TraverseSubtree() { // first layout updating cycle
+		if ApplyLayout(c) {
+			layoutStack = append(layoutStack, c)
+		}
+	}
+	for i := len(layoutStack) - 1; i >= 0; i-- { // second pass, processing the incomplete geometry layouts, going backwards
+		ApplyLayout(layoutStack[i])
+	}
 }
@@ -18,3 +18,63 @@ func testCalculateGrid(percentages []int, targetSize int, expected []int, t *tes
 // 	testCalculateGrid([]int{0, 0, 0, 0}, 100, []int{25, 25, 25, 25}, t)
 // 	testCalculateGrid([]int{50, 0, 0, 0}, 100, []int{50, 17, 17, 16}, t)
 // }
+
+// a box of the given width holding texts laid out like the stories list
+func buildTestList(width int, texts ...string) (*BaseComponent, []*BaseComponent) {
+	root := NewBox(FixedWidth)
+	root.SetSize(width, -1)
+	children := make([]*BaseComponent, len(texts))
+	for i, text := range texts {
+		child := NewText(text, FixedWidth)
+		root.AddChild(&child)
+		children[i] = &child
+	}
+	return &root, children
+}
+
+func Test_FixedWidthLayout_StacksTheChildren(t *testing.T) {
+	root, children := buildTestList(20, "one two three four five", "six")
+	LayoutSubtree(root)
+	if children[0].Width() != 20 || children[0].Height() != 2 || children[0].Y() != 0 {
+		t.Errorf("Expected the first text to be wrapped on 2 lines at the top, got %dx%d at %d", children[0].Width(), children[0].Height(), children[0].Y())
+	}
+	if children[1].Height() != 1 || children[1].Y() != 2 {
+		t.Errorf("Expected the second text below the first one, got height %d at %d", children[1].Height(), children[1].Y())
+	}
+	if root.Height() != 3 {
+		t.Errorf("Expected the height of the box to add up the heights of the texts, got %d", root.Height())
+	}
+}
+
+func Test_FixedWidthLayout_StacksTheChildrenWithAFixedHeight(t *testing.T) {
+	root, children := buildTestList(20, "one two three four five", "six")
+	root.SetFixedHeight(10)
+	LayoutSubtree(root)
+	if root.Height() != 10 {
+		t.Errorf("Expected the fixed height, got %d", root.Height())
+	}
+	if children[1].Y() != 2 {
+		t.Errorf("Expected the children to be stacked in a box with a fixed height, got the second one at %d", children[1].Y())
+	}
+}
+
+func Test_ApplyLayout_NeedsFollowUpUntilTheChildrenHaveAHeight(t *testing.T) {
+	root, children := buildTestList(20, "one")
+	if !ApplyLayout(root) {
+		t.Errorf("Expected the box to need a follow up while its child has no height")
+	}
+	if ApplyLayout(children[0]) {
+		t.Errorf("Expected the text to be laid out at once")
+	}
+	if ApplyLayout(root) || root.Height() != 1 {
+		t.Errorf("Expected the box to be laid out once its child has a height, got %d", root.Height())
+	}
+
+	grid := NewBox(HorizontalGrid)
+	grid.SetSize(20, -1)
+	cell := NewBox(HorizontalGrid)
+	grid.AddChild(&cell)
+	if !ApplyLayout(&grid) {
+		t.Errorf("Expected the grid to need a follow up without a height")
+	}
+}
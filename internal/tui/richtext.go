@@ -0,0 +1,70 @@
+package tui
+
+import (
+	"fmt"
+	"hnterminal/internal/richtext"
+
+	"github.com/gdamore/tcell/v3/color"
+)
+
+var LINK_COLOR = color.Skyblue
+var CODE_COLOR = color.LightGreen
+var QUOTE_COLOR = color.Gray
+
+// RichText shows a styled document like the text of an item, wrapped to the width of the component
+type RichText struct {
+	document richtext.Document
+	lines    []richtext.Line
+}
+
+func (t *RichText) Draw(c *BaseComponent, tui *TUI) error {
+	for y := 0; y < min(c.height, len(t.lines)); y++ {
+		x := 0
+		for _, span := range t.lines[y] {
+			style := c.style
+			if span.Style.Has(richtext.Italic) {
+				style = style.Italic(true)
+			}
+			if span.Style.Has(richtext.Code) {
+				style = style.Foreground(CODE_COLOR)
+			}
+			if span.Style.Has(richtext.Quote) {
+				style = style.Foreground(QUOTE_COLOR)
+			}
+			if span.Style.Has(richtext.Link) {
+				style = style.Foreground(LINK_COLOR).Underline(true).Url(span.Url)
+			}
+			for _, chr := range span.Text {
+				if x >= c.width { // the long words and code lines are cut
+					break
+				}
+				tui.screen.SetContent(c.AbsoluteX()+x, c.AbsoluteY()+y, chr, nil, style)
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+func (t *RichText) OnUpdate(c *BaseComponent) error {
+	if c.width > c.padding.Left+c.padding.Right {
+		t.lines = t.document.Wrap(c.width - c.padding.Left - c.padding.Right)
+		c.fixedHeight = len(t.lines) + c.padding.Top + c.padding.Bottom
+	}
+	return nil
+}
+
+// SetHtml replaces the document with the HTML text of an item
+func (t *RichText) SetHtml(text string) {
+	t.document = richtext.Parse(text)
+	t.lines = nil
+}
+
+func (t *RichText) String() string {
+	return fmt.Sprintf("RichText (blocks: %d)", len(t.document))
+}
+
+func NewRichText(html string, layout Layout) BaseComponent {
+	t := RichText{document: richtext.Parse(html)}
+	return NewComponent(&t, layout)
+}
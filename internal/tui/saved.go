@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+type savedLoadedEvent struct {
+	generation int
+	count      int
+}
+
+// posted when a story was saved or unsaved, err is set if it failed
+type savedToggledEvent struct {
+	id    int
+	saved bool
+	err   error
+}
+
+// loads the saved items instead of the feed
+func (t *TUI) loadSavedStories(ctx context.Context, generation int) {
+	savedItems, err := t.repo.SavedItems()
+	if err != nil {
+		log.Printf("error while loading the saved items: %v", err)
+		return
+	}
+	t.post(savedLoadedEvent{generation, len(savedItems)})
+	ids := make([]int, len(savedItems))
+	for i, saved := range savedItems {
+		ids[i] = saved.Id
+	}
+	t.streamStories(generation, t.repo.StreamItems(ctx, ids))
+}
+
+func (t *TUI) onSavedLoaded(ev savedLoadedEvent) {
+	if ev.generation != t.storiesGeneration {
+		return
+	}
+	t.setFeedStatus(fmt.Sprintf("saved items (%d) | v: back to the %s stories", ev.count, t.config.Feed), FEED_STATUS_STYLE)
+}
+
+// switches between the feed and the saved items
+func (t *TUI) toggleSavedView() {
+	if t.view == savedView {
+		t.showView(feedView)
+	} else {
+		t.showView(savedView)
+	}
+}
+
+/*
+saves the selected story or unsaves it if it is saved, in the background since saving may
+fetch the story. The key is ignored while the story is being saved.
+*/
+func (t *TUI) toggleSaved() {
+	if t.selected >= len(t.stories) {
+		return
+	}
+	id := t.stories[t.selected].Id
+	if t.saving[id] {
+		return
+	}
+	t.saving[id] = true
+	save := !t.saved[id]
+	go func() {
+		var err error
+		if save {
+			_, err = t.repo.Save(t.ctx, id, nil, "")
+		} else {
+			err = t.repo.Unsave(id)
+		}
+		t.post(savedToggledEvent{id, save, err})
+	}()
+}
+
+func (t *TUI) onSavedToggled(ev savedToggledEvent) {
+	delete(t.saving, ev.id)
+	if ev.err != nil {
+		log.Printf("error while saving or unsaving %d: %v", ev.id, ev.err)
+		return
+	}
+	if ev.saved {
+		t.saved[ev.id] = true
+	} else {
+		delete(t.saved, ev.id)
+	}
+	for i, story := range t.stories {
+		if story.Id == ev.id {
+			t.storyComponents[i].Children()[1].kind.(*Text).SetText(t.storyDetails(story))
+			t.storyComponents[i].SetDirty(true)
+		}
+	}
+}
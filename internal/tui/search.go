@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"hnterminal/internal/search"
+	"log"
+
+	"github.com/gdamore/tcell/v3"
+	"github.com/gdamore/tcell/v3/color"
+)
+
+// the maximum number of search results listed
+const TUI_MAX_SEARCH_RESULTS = 50
+
+var PROMPT_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.White).Bold(true)
+
+// the status replaced by the prompt, restored when the prompt is closed
+type promptState struct {
+	text        string
+	statusText  string
+	statusStyle tcell.Style
+}
+
+type searchLoadedEvent struct {
+	generation int
+	query      string
+	count      int
+	err        error
+}
+
+// opens the search prompt in place of the feed status
+func (t *TUI) openSearchPrompt() {
+	if t.index == nil {
+		return
+	}
+	t.prompt = &promptState{t.searchQuery, t.feedStatus.kind.(*Text).text, t.feedStatus.Style()}
+	t.showPrompt()
+}
+
+func (t *TUI) showPrompt() {
+	t.feedStatus.kind.(*Text).SetText("search: " + t.prompt.text + "_")
+	t.feedStatus.SetStyle(PROMPT_STYLE)
+	t.feedStatus.SetDirty(true)
+}
+
+// sets the status above the stories, or the one restored when the prompt is closed if it is open
+func (t *TUI) setFeedStatus(text string, style tcell.Style) {
+	if t.prompt != nil {
+		t.prompt.statusText = text
+		t.prompt.statusStyle = style
+		return
+	}
+	t.feedStatus.kind.(*Text).SetText(text)
+	t.feedStatus.SetStyle(style)
+	t.feedStatus.SetDirty(true)
+}
+
+// edits the prompt, enter searches the typed query and escape closes the prompt
+func (t *TUI) onPromptKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		status := t.prompt
+		t.prompt = nil
+		t.setFeedStatus(status.statusText, status.statusStyle)
+	case tcell.KeyEnter:
+		query := t.prompt.text
+		t.prompt = nil
+		if query == "" {
+			t.showView(feedView)
+			return
+		}
+		t.searchQuery = query
+		t.showView(searchView)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if runes := []rune(t.prompt.text); len(runes) > 0 {
+			t.prompt.text = string(runes[:len(runes)-1])
+		}
+		t.showPrompt()
+	case tcell.KeyRune:
+		t.prompt.text += ev.Str()
+		t.showPrompt()
+	}
+}
+
+// lists the cached items matching the query, the most relevant first
+func (t *TUI) loadSearchResults(ctx context.Context, generation int, query string) {
+	parsed, err := search.ParseQuery(query)
+	if err != nil {
+		t.post(searchLoadedEvent{generation, query, 0, err})
+		return
+	}
+	results, err := t.index.Search(parsed, TUI_MAX_SEARCH_RESULTS)
+	t.post(searchLoadedEvent{generation, query, len(results), err})
+	for _, result := range results {
+		if ctx.Err() != nil {
+			return
+		}
+		visit, err := t.repo.LoadVisit(result.Item.Id)
+		if err != nil {
+			log.Printf("error while loading the visit of %d: %v", result.Item.Id, err)
+		}
+		t.post(storyLoadedEvent{generation, result.Item, visit})
+	}
+}
+
+func (t *TUI) onSearchLoaded(ev searchLoadedEvent) {
+	if ev.generation != t.storiesGeneration {
+		return
+	}
+	status := fmt.Sprintf("search \"%s\" (%d) | /: search again, v: saved items", ev.query, ev.count)
+	style := FEED_STATUS_STYLE
+	if ev.err != nil {
+		log.Printf("error while searching %q: %v", ev.query, ev.err)
+		status = fmt.Sprintf("search \"%s\": %v", ev.query, ev.err)
+		style = OFFLINE_STATUS_STYLE
+	}
+	t.setFeedStatus(status, style)
+}
@@ -0,0 +1,432 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/rules"
+	"hnterminal/internal/utils"
+	"iter"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v3"
+	"github.com/gdamore/tcell/v3/color"
+)
+
+const TUI_COMMENT_DEPTH = 3
+const TUI_MAX_COMMENTS = 200
+const COMMENT_INDENT = 2
+
+var STORY_STYLE = DEFAULT_STYLE
+var SELECTED_STORY_STYLE = tcell.StyleDefault.Background(color.Navy).Foreground(color.White)
+var STORY_DETAILS_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Gray)
+var READ_STORY_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Gray)
+var COMMENT_HEADER_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Orange)
+var NEW_COMMENT_HEADER_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Yellow).Bold(true)
+var FEED_STATUS_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Gray)
+var OFFLINE_STATUS_STYLE = tcell.StyleDefault.Background(color.Reset).Foreground(color.Yellow)
+
+// the kinds of lists shown in the stories list
+type storiesView int
+
+const (
+	feedView storiesView = iota
+	savedView
+	searchView
+)
+
+type feedLoadedEvent struct {
+	generation int
+	feed       hnapi.Feed
+	cached     *hnapi.CachedFeed
+	offline    bool
+}
+
+type storiesHiddenEvent struct {
+	generation int
+	hidden     rules.Hidden
+}
+
+type storyLoadedEvent struct {
+	generation int
+	story      *hnapi.Item
+	visit      *hnapi.Visit
+}
+
+type commentsLoadedEvent struct {
+	storyId int
+	tree    *hnapi.CommentNode
+	err     error
+}
+
+type itemUpdatedEvent struct {
+	item *hnapi.Item
+}
+
+// posts the data to the event loop, gives up if the TUI is quitting
+func (t *TUI) post(data any) {
+	select {
+	case t.screen.EventQ() <- tcell.NewEventInterrupt(data):
+	case <-t.ctx.Done():
+	}
+}
+
+/*
+clears the stories list and loads the stories of the current view in the background, adding
+them to the list one by one. The events of the previous loads are ignored by their generation.
+*/
+func (t *TUI) loadStories() {
+	if t.storiesCancel != nil {
+		t.storiesCancel()
+	}
+	ctx, cancel := context.WithCancel(t.ctx)
+	t.storiesCancel = cancel
+	t.storiesGeneration++
+	generation := t.storiesGeneration
+	t.stories = nil
+	t.storyComponents = nil
+	t.selected = 0
+	if t.commentsCancel != nil {
+		t.commentsCancel()
+	}
+	commentsList.RemoveChildren()
+	commentsList.SetDirty(true)
+	t.commentComponents = make(map[int]*BaseComponent)
+	storiesList.RemoveChildren()
+	storiesList.AddChild(t.feedStatus)
+	storiesList.SetDirty(true)
+	switch t.view {
+	case savedView:
+		go t.loadSavedStories(ctx, generation)
+		return
+	case searchView:
+		go t.loadSearchResults(ctx, generation, t.searchQuery)
+		return
+	}
+	feedName := t.config.Feed
+	go func() {
+		feed, err := hnapi.ParseFeed(feedName)
+		if err != nil {
+			log.Printf("error while loading the stories: %v", err)
+			return
+		}
+		cachedFeed, err := t.repo.GetFeed(ctx, feed)
+		if err != nil {
+			log.Printf("error while loading the stories: %v", err)
+			return
+		}
+		t.post(feedLoadedEvent{generation, feed, cachedFeed, t.repo.IsOffline()})
+		hidden := rules.Hidden{}
+		t.streamStories(generation, t.rules.StreamStories(ctx, t.repo, cachedFeed.Ids, t.config.StoryCount, hidden))
+		if len(hidden) > 0 && ctx.Err() == nil {
+			t.post(storiesHiddenEvent{generation, hidden})
+		}
+	}()
+}
+
+// posts the stories with their visits as they are loaded
+func (t *TUI) streamStories(generation int, results iter.Seq[hnapi.ItemResult]) {
+	for result := range results {
+		if result.Err != nil {
+			log.Printf("error while loading story %d: %v", result.Id, result.Err)
+			continue
+		}
+		visit, err := t.repo.LoadVisit(result.Id)
+		if err != nil {
+			log.Printf("error while loading the visit of story %d: %v", result.Id, err)
+		}
+		t.post(storyLoadedEvent{generation, result.Item, visit})
+	}
+}
+
+// switches the stories list to the view
+func (t *TUI) showView(view storiesView) {
+	t.view = view
+	if view == feedView {
+		t.setFeedStatus(t.config.Feed+" stories | f: next feed", FEED_STATUS_STYLE)
+	}
+	t.loadStories()
+}
+
+// shows the next feed of hnapi.Feeds, or the current feed if another view is shown
+func (t *TUI) nextFeed() {
+	if t.view == feedView {
+		feed, _ := hnapi.ParseFeed(t.config.Feed) // an unknown feed is shown as top
+		next := (slices.Index(hnapi.Feeds[:], feed) + 1) % len(hnapi.Feeds)
+		t.config.Feed = hnapi.Feeds[next].String()
+	}
+	t.showView(feedView)
+}
+
+// shows the feed above the stories and how old it is when offline
+func (t *TUI) onFeedLoaded(ev feedLoadedEvent) {
+	if ev.generation != t.storiesGeneration {
+		return
+	}
+	t.feedLoaded = ev
+	t.setFeedStatus(feedStatus(ev))
+}
+
+// the status of the loaded feed, how old it is when offline
+func feedStatus(ev feedLoadedEvent) (string, tcell.Style) {
+	status := fmt.Sprintf("%s stories | f: next feed", ev.feed)
+	style := FEED_STATUS_STYLE
+	if ev.offline {
+		status += fmt.Sprintf(" | offline, cached %s", utils.RelativeTime(ev.cached.FetchedTime()))
+		style = OFFLINE_STATUS_STYLE
+	}
+	return status, style
+}
+
+// adds how many stories each rule hid to the status of the feed
+func (t *TUI) onStoriesHidden(ev storiesHiddenEvent) {
+	if ev.generation != t.storiesGeneration {
+		return
+	}
+	status, style := feedStatus(t.feedLoaded)
+	t.setFeedStatus(fmt.Sprintf("%s | hidden %s", status, ev.hidden), style)
+}
+
+func (t *TUI) onStoryLoaded(ev storyLoadedEvent) {
+	if ev.generation != t.storiesGeneration {
+		return
+	}
+	t.stories = append(t.stories, ev.story)
+	if ev.visit != nil {
+		t.visits[ev.story.Id] = ev.visit
+	}
+	storyComponent := t.newStoryComponent(ev.story)
+	t.storyComponents = append(t.storyComponents, storyComponent)
+	storiesList.AddChild(storyComponent)
+	storiesList.SetDirty(true)
+	if len(t.stories) == 1 {
+		t.selectStory(0)
+	}
+	t.watchVisibleItems()
+}
+
+// makes the updater refetch the changed stories and comments on the screen
+func (t *TUI) watchVisibleItems() {
+	ids := make([]int, 0, len(t.stories)+len(t.commentComponents))
+	for _, story := range t.stories {
+		ids = append(ids, story.Id)
+	}
+	for id := range t.commentComponents {
+		ids = append(ids, id)
+	}
+	t.updater.Watch(ids)
+}
+
+// updates the story or comment in place if it is on the screen
+func (t *TUI) onItemUpdated(ev itemUpdatedEvent) {
+	for i, story := range t.stories {
+		if story.Id == ev.item.Id {
+			t.stories[i] = ev.item
+			storyBox := t.storyComponents[i]
+			storyBox.Children()[0].kind.(*Text).SetText(storyTitle(ev.item))
+			storyBox.Children()[1].kind.(*Text).SetText(t.storyDetails(ev.item))
+			storyBox.SetDirty(true)
+			return
+		}
+	}
+	if commentBox, ok := t.commentComponents[ev.item.Id]; ok && len(commentBox.Children()) > 1 {
+		commentBox.Children()[1].kind.(*RichText).SetHtml(ev.item.Text)
+		commentBox.SetDirty(true)
+	}
+}
+
+// the title of a story, the start of the text for the saved comments
+func storyTitle(story *hnapi.Item) string {
+	if story.Title == "" && story.Text != "" {
+		return utils.Truncate(commentText(story), 80)
+	}
+	return story.Title
+}
+
+func (t *TUI) storyDetails(story *hnapi.Item) string {
+	details := fmt.Sprintf("%d points by %s | %d comments", story.Score, story.By, story.CommentsCount)
+	if newComments := t.visits[story.Id].NewCommentsCount(story); newComments > 0 {
+		details += fmt.Sprintf(" (%d new)", newComments)
+	}
+	if t.saved[story.Id] {
+		details += " | saved"
+	}
+	return details
+}
+
+// the style of the title of a story that is not selected
+func storyTitleStyle(visit *hnapi.Visit) tcell.Style {
+	if visit != nil {
+		return READ_STORY_STYLE
+	}
+	return STORY_STYLE
+}
+
+func commentText(comment *hnapi.Item) string {
+	return strings.TrimSpace(utils.HtmlToText(comment.Text))
+}
+
+func (t *TUI) newStoryComponent(story *hnapi.Item) *BaseComponent {
+	storyBox := NewBox(FixedWidth)
+	storyBox.SetPadding(Padding{0, 0, 0, 1})
+	title := NewText(storyTitle(story), FixedWidth)
+	title.SetStyle(storyTitleStyle(t.visits[story.Id]))
+	storyBox.AddChild(&title)
+	details := NewText(t.storyDetails(story), FixedWidth)
+	details.SetStyle(STORY_DETAILS_STYLE)
+	storyBox.AddChild(&details)
+	return &storyBox
+}
+
+// selects the story by its index and loads its comments, the loading of the
+// previously selected story's comments is cancelled
+func (t *TUI) selectStory(index int) {
+	if index < 0 || index >= len(t.stories) {
+		return
+	}
+	storyComponents := t.storyComponents
+	if t.selected < len(storyComponents) {
+		storyComponents[t.selected].SetStyle(DEFAULT_STYLE)
+		storyComponents[t.selected].Children()[0].SetStyle(storyTitleStyle(t.visits[t.stories[t.selected].Id]))
+		storyComponents[t.selected].SetDirty(true)
+	}
+	t.selected = index
+	storyComponents[index].SetStyle(SELECTED_STORY_STYLE)
+	storyComponents[index].Children()[0].SetStyle(SELECTED_STORY_STYLE)
+	storyComponents[index].SetDirty(true)
+	t.loadComments(t.stories[index].Id)
+}
+
+func (t *TUI) loadComments(storyId int) {
+	if t.commentsCancel != nil {
+		t.commentsCancel()
+	}
+	t.shownTree = nil
+	commentsList.RemoveChildren()
+	commentsList.SetDirty(true)
+	t.commentComponents = make(map[int]*BaseComponent)
+	ctx, cancel := context.WithCancel(t.ctx)
+	t.commentsCancel = cancel
+	depth := TUI_COMMENT_DEPTH
+	if t.config.Depth > 0 {
+		depth = t.config.Depth
+	}
+	go func() {
+		tree, err := t.repo.GetCommentTree(ctx, storyId, depth)
+		if ctx.Err() != nil { // the story is not selected anymore
+			return
+		}
+		t.post(commentsLoadedEvent{storyId, tree, err})
+	}()
+}
+
+func (t *TUI) onCommentsLoaded(ev commentsLoadedEvent) {
+	if ev.tree == nil {
+		log.Printf("error while loading the comments of %d: %v", ev.storyId, ev.err)
+		return
+	}
+	if ev.err != nil {
+		log.Printf("some comments of %d could not be loaded: %v", ev.storyId, ev.err)
+	}
+	if len(t.stories) == 0 || t.stories[t.selected].Id != ev.storyId {
+		return
+	}
+	// the visit is recorded only once the story is opened, see openStory
+	previousVisit, err := t.repo.LoadVisit(ev.storyId)
+	if err != nil {
+		log.Printf("error while loading the visit of %d: %v", ev.storyId, err)
+	}
+	hidden := rules.Hidden{}
+	t.rules.FilterTree(ev.tree, hidden)
+	commentsList.RemoveChildren()
+	if ev.tree.Item.Text != "" { // the text of the ask HN stories
+		storyText := NewRichText(ev.tree.Item.Text, FixedWidth)
+		storyText.SetPadding(Padding{0, 0, 0, 1})
+		commentsList.AddChild(&storyText)
+	}
+	if len(hidden) > 0 {
+		hiddenStatus := NewText(fmt.Sprintf("hidden %s", hidden), FixedWidth)
+		hiddenStatus.SetStyle(FEED_STATUS_STYLE)
+		hiddenStatus.SetPadding(Padding{0, 0, 0, 1})
+		commentsList.AddChild(&hiddenStatus)
+	}
+	count := 0
+	var addComments func(node *hnapi.CommentNode)
+	addComments = func(node *hnapi.CommentNode) {
+		for _, child := range node.Children {
+			if count >= TUI_MAX_COMMENTS || (child.IsRemoved() && t.config.HideDead) {
+				continue
+			}
+			commentComponent := newCommentComponent(child, previousVisit.IsNew(child.Item.Id))
+			commentsList.AddChild(commentComponent)
+			t.commentComponents[child.Item.Id] = commentComponent
+			count++
+			addComments(child)
+		}
+	}
+	addComments(ev.tree)
+	t.shownTree = ev.tree
+	commentsList.SetDirty(true)
+	t.watchVisibleItems()
+}
+
+/*
+openStory records the visit of the selected story once its comments are shown, the stories
+and comments only previewed while moving the selection are not marked as read
+*/
+func (t *TUI) openStory() {
+	if t.shownTree == nil || len(t.stories) == 0 || t.stories[t.selected].Id != t.shownTree.Item.Id {
+		return
+	}
+	if _, err := t.repo.MarkVisited(t.shownTree); err != nil {
+		log.Printf("error while recording the visit of %d: %v", t.shownTree.Item.Id, err)
+		return
+	}
+	t.onStoryVisited(t.shownTree.Item.Id)
+}
+
+// refreshes the new comments count of the visited story
+func (t *TUI) onStoryVisited(storyId int) {
+	visit, err := t.repo.LoadVisit(storyId)
+	if err != nil || visit == nil {
+		return
+	}
+	t.visits[storyId] = visit
+	for i, story := range t.stories {
+		if story.Id == storyId {
+			t.storyComponents[i].Children()[1].kind.(*Text).SetText(t.storyDetails(story))
+			t.storyComponents[i].SetDirty(true)
+		}
+	}
+}
+
+func newCommentComponent(node *hnapi.CommentNode, isNew bool) *BaseComponent {
+	commentBox := NewBox(FixedWidth)
+	commentBox.SetPadding(Padding{(node.Depth - 1) * COMMENT_INDENT, 0, 0, 1})
+	comment := node.Item
+	header := ""
+	switch {
+	case comment.IsDeleted:
+		header = "[deleted]"
+	case comment.IsDead:
+		header = fmt.Sprintf("[dead] %s %s", comment.By, utils.RelativeTime(time.Unix(int64(comment.Time), 0)))
+	default:
+		header = fmt.Sprintf("%s %s", comment.By, utils.RelativeTime(time.Unix(int64(comment.Time), 0)))
+	}
+	headerStyle := COMMENT_HEADER_STYLE
+	if isNew {
+		header = "[new] " + header
+		headerStyle = NEW_COMMENT_HEADER_STYLE
+	}
+	headerText := NewText(header, FixedWidth)
+	headerText.SetStyle(headerStyle)
+	commentBox.AddChild(&headerText)
+	if !node.IsRemoved() {
+		body := NewRichText(comment.Text, FixedWidth)
+		commentBox.AddChild(&body)
+	}
+	return &commentBox
+}
@@ -1,8 +1,15 @@
 package tui
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/rules"
+	"hnterminal/internal/search"
 	"hnterminal/internal/utils"
+	"log"
 
 	"sync"
 
@@ -19,6 +26,32 @@ type TUI struct {
 	drawMap      map[int]*BaseComponent
 	mutex        sync.Mutex
 	root         *BaseComponent
+	api          *hnapi.ApiClient
+	repo         *hnapi.Repository
+	// cancelled when quitting, aborts all the pending requests
+	ctx    context.Context
+	cancel context.CancelFunc
+	// cancels the loading of the comments of the previously selected story
+	commentsCancel  context.CancelFunc
+	stories         []*hnapi.Item
+	storyComponents []*BaseComponent
+	feedStatus      *BaseComponent       // the feed and its age above the stories
+	visits          map[int]*hnapi.Visit // the last visits of the read stories by id
+	saved           map[int]bool         // the ids of the saved items
+	saving          map[int]bool         // the ids of the items being saved or unsaved
+	view            storiesView          // what the stories list shows
+	index           *search.Index        // nil if the search index could not be opened
+	rules           *rules.Engine        // nil with --no-filter
+	searchQuery     string               // the query of the search view
+	prompt          *promptState         // the search prompt, nil when it is closed
+	// cancels the loading of the stories of the previous view
+	storiesCancel     context.CancelFunc
+	storiesGeneration int
+	feedLoaded        feedLoadedEvent // the feed shown in the status above the stories
+	selected          int
+	commentComponents map[int]*BaseComponent // the comments on the screen by id
+	shownTree         *hnapi.CommentNode     // the comments on the screen, nil while they are loading
+	updater           *hnapi.Updater
 }
 
 func New(config *config.Config) *TUI {
@@ -36,6 +69,9 @@ func New(config *config.Config) *TUI {
 		defaultStyle: defaultStyle,
 		maxId:        -1,
 		drawMap:      make(map[int]*BaseComponent),
+		visits:       make(map[int]*hnapi.Visit),
+		saved:        make(map[int]bool),
+		saving:       make(map[int]bool),
 	}
 	screen.SetStyle(tui.defaultStyle)
 	screen.EnableMouse()
@@ -61,52 +97,64 @@ var storiesList BaseComponent
 var commentsList BaseComponent
 
 func (t *TUI) Init() {
-	t.root.SetStyle(tcell.StyleDefault.Foreground(color.White).Background(color.Red))
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.api = hnapi.NewApiClient(nil, t.config.BaseUrl)
+	repo, err := hnapi.NewRepository(t.api, t.config)
+	if errors.Is(err, hnapi.ErrStoreLocked) {
+		log.Printf("%v, running without the cache", err)
+		repo = hnapi.NewRepositoryWithStore(t.api, t.config, hnapi.NewMemoryStore())
+	} else if err != nil {
+		t.screen.Fini()
+		utils.HandleError(fmt.Errorf("the cache could not be opened: %w\n", err), utils.ErrorSeverityFatal)
+	}
+	t.repo = repo
+	t.repo.SetOffline(t.config.Offline)
+	if t.index, err = search.Attach(t.repo); err != nil {
+		log.Printf("error while opening the search index: %v", err)
+	}
+	if !t.config.NoFilter {
+		if t.rules, err = rules.Compile(t.config.Rules); err != nil {
+			t.screen.Fini()
+			utils.HandleError(fmt.Errorf("invalid rules in %s: %w\n", config.GetConfigPath(), err), utils.ErrorSeverityFatal)
+		}
+	}
+	if savedItems, err := t.repo.SavedItems(); err == nil {
+		for _, saved := range savedItems {
+			t.saved[saved.Id] = true
+		}
+	} else {
+		log.Printf("error while loading the saved items: %v", err)
+	}
+	t.updater = hnapi.NewUpdater(t.repo, hnapi.DEFAULT_UPDATE_INTERVAL)
+	if !t.config.Offline { // offline only the cache is used
+		// the visible stories are updated by the listener below once refetched
+		t.repo.SetStaleWhileRevalidate(true)
+		t.repo.OnItemUpdated(func(item *hnapi.Item) {
+			t.post(itemUpdatedEvent{item})
+		})
+		go t.updater.Run(t.ctx)
+	}
+
+	t.root.SetStyle(DEFAULT_STYLE)
 	t.root.SetLayout(HorizontalGrid)
 	storiesList = NewBox(FixedWidth)
-	storiesList.SetStyle(tcell.StyleDefault.Foreground(color.White).Background(color.Green))
+	storiesList.SetStyle(DEFAULT_STYLE)
 	storiesList.SetWidthPercent(40)
+	storiesList.SetPadding(Padding{1, 0, 1, 0})
+	feedStatus := NewText(t.config.Feed+" stories", FixedWidth)
+	feedStatus.SetStyle(FEED_STATUS_STYLE)
+	feedStatus.SetPadding(Padding{0, 0, 0, 1})
+	t.feedStatus = &feedStatus
+	storiesList.AddChild(t.feedStatus)
 	t.root.AddChild(&storiesList)
-	commentsList := NewBox(FixedWidth)
-	commentsList.SetStyle(tcell.StyleDefault.Foreground(color.White).Background(color.Red))
+	commentsList = NewBox(FixedWidth)
+	commentsList.SetStyle(DEFAULT_STYLE)
+	commentsList.kind.(*Box).SetBorderStyle(BorderStyleRounded)
+	commentsList.kind.(*Box).SetBorder(Border{true, false, false, false})
+	commentsList.SetPadding(Padding{2, 0, 1, 0})
 	t.root.AddChild(&commentsList)
 
-	story1 := NewBox(HorizontalGrid)
-	story1.SetStyle(tcell.StyleDefault.Foreground(color.White).Background(color.Blue))
-	storiesList.AddChild(&story1)
-
-	story1Left := NewBox(FixedWidth)
-	story1Left.SetWidthPercent(50)
-	story1Left.SetPadding(Padding{4, 1, 5, 2})
-	story1Left.SetStyle(tcell.StyleDefault.Foreground(color.Yellow).Background(color.Gray))
-	story1LeftText := NewText("Story 1 with a long long text to test if the wrapping and the automatic height calculation works or not, so I can fix it if something is not looking alright", FixedWidth)
-	story1LeftText.SetStyle(tcell.StyleDefault.Foreground(color.White).Background(color.Blue))
-	story1LeftText.kind.(*Text).SetAlignment(TextAlignLeft)
-	story1Left.AddChild(&story1LeftText)
-	story1.AddChild(&story1Left)
-
-	story1Right := NewBox(FixedWidth)
-	story1Right.SetStyle(tcell.StyleDefault.Foreground(color.Black).Background(color.LightCyan))
-	story1Right.kind.(*Box).SetBorderStyle(BorderStyleRounded)
-	story1Right.kind.(*Box).SetBorder(Border{true, false, true, true})
-	story1Right.SetPadding(Padding{3, 1, 3, 1})
-	story1.AddChild(&story1Right)
-	story1RightText := NewText("Just a short text, nothing to see here", FixedWidth)
-	story1RightText.SetStyle(tcell.StyleDefault.Foreground(color.Pink).Background(color.BlueViolet))
-	story1RightText.kind.(*Text).SetAlignment(TextAlignLeft)
-	story1Right.AddChild(&story1RightText)
-
-	popup := NewFloatingBox(FixedWidth)
-	popup.dirty = true
-	popup.SetStyle(tcell.StyleDefault.Foreground(color.Black).Background(color.Pink))
-	popup.kind.(*Box).SetBorderStyle(BorderStyleRounded)
-	popup.SetPadding(Padding{2, 2, 2, 2})
-	popup.SetFixedWidth(100)
-	popupText := NewText("This is a popup", FixedWidth)
-	popupText.SetStyle(tcell.StyleDefault.Foreground(color.Black).Background(color.AquaMarine))
-	popupText.kind.(*Text).SetAlignment(TextAlignCenter)
-	popup.AddChild(&popupText)
-	t.root.AddChild(&popup)
+	t.loadStories()
 }
 
 func (t *TUI) UpdateRoot() {
@@ -128,7 +176,30 @@ func (t *TUI) Run() {
 		switch ev := ev.(type) {
 		case *tcell.EventResize:
 			t.Draw()
+		case *tcell.EventInterrupt:
+			switch data := ev.Data().(type) {
+			case feedLoadedEvent:
+				t.onFeedLoaded(data)
+			case storiesHiddenEvent:
+				t.onStoriesHidden(data)
+			case savedLoadedEvent:
+				t.onSavedLoaded(data)
+			case savedToggledEvent:
+				t.onSavedToggled(data)
+			case searchLoadedEvent:
+				t.onSearchLoaded(data)
+			case storyLoadedEvent:
+				t.onStoryLoaded(data)
+			case commentsLoadedEvent:
+				t.onCommentsLoaded(data)
+			case itemUpdatedEvent:
+				t.onItemUpdated(data)
+			}
 		case *tcell.EventKey:
+			if t.prompt != nil {
+				t.onPromptKey(ev)
+				continue
+			}
 			switch ev.Key() {
 			case tcell.KeyCtrlC, tcell.KeyEscape:
 				t.Quit()
@@ -137,6 +208,23 @@ func (t *TUI) Run() {
 				storiesList.SetWidthPercent(min(storiesList.WidthPercent()+1, 100))
 			case tcell.KeyLeft:
 				storiesList.SetWidthPercent(max(storiesList.WidthPercent()-1, 5))
+			case tcell.KeyDown:
+				t.selectStory(t.selected + 1)
+			case tcell.KeyUp:
+				t.selectStory(t.selected - 1)
+			case tcell.KeyEnter:
+				t.openStory()
+			case tcell.KeyRune:
+				switch ev.Str() {
+				case "s":
+					t.toggleSaved()
+				case "v":
+					t.toggleSavedView()
+				case "f":
+					t.nextFeed()
+				case "/":
+					t.openSearchPrompt()
+				}
 				// case tcell.KeyLeft:
 				// 	box1.SetMinWidth(box1.MinWidth() - 1)
 				// 	box1.SetMaxWidth(box1.MaxWidth() - 1)
@@ -169,15 +257,7 @@ func (t *TUI) Draw() {
 			for c := range changesRoot.Traverse() { // reset all components in the subtree
 				c.ResetGeometry()
 			}
-			layoutStack := make([]*BaseComponent, 0)
-			for c := range changesRoot.TraverseSubtree() { // first layout updating cycle
-				if ApplyLayout(c) {
-					layoutStack = append(layoutStack, c)
-				}
-			}
-			for i := len(layoutStack) - 1; i >= 0; i-- { // second pass, processing the incomplete geometry layouts, going backwards
-				ApplyLayout(layoutStack[i])
-			}
+			LayoutSubtree(changesRoot)
 		}
 	}
 
@@ -198,7 +278,14 @@ func (t *TUI) Draw() {
 
 func (t *TUI) Quit() {
 	maybePanic := recover()
+	if t.cancel != nil {
+		t.cancel()
+	}
 	t.screen.Fini()
+	if t.repo != nil {
+		t.repo.Close()
+		t.repo = nil
+	}
 	if maybePanic != nil {
 		panic(maybePanic)
 	}
@@ -1,62 +1,825 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"hnterminal/internal/config"
 	"hnterminal/internal/hnapi"
+	"hnterminal/internal/richtext"
+	"hnterminal/internal/rules"
+	"hnterminal/internal/search"
+	"hnterminal/internal/server"
+	"hnterminal/internal/syndication"
 	"hnterminal/internal/utils"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const COMMENT_TEXT_WIDTH = 80
+const COMMENT_INDENT = "  "
+const ANSI_DIM = "\x1b[2m"
+const ANSI_RESET = "\x1b[0m"
+const SERVE_READ_HEADER_TIMEOUT = time.Second * 10
+const SERVE_SHUTDOWN_TIMEOUT = time.Second * 5
+
 type Cli struct {
-	config *config.Config
-	api    *hnapi.ApiClient
-	repo   *hnapi.Repository
+	config  *config.Config
+	api     *hnapi.ApiClient
+	repo    *hnapi.Repository
+	index   *search.Index
+	rules   *rules.Engine // nil with --no-filter
+	out     io.Writer
+	color   bool          // the output is a terminal, the read stories are dimmed
+	records *recordWriter // nil for the text output
 }
 
 func NewCli(config *config.Config) *Cli {
-	return &Cli{config, nil, nil}
+	return &Cli{config, nil, nil, nil, nil, os.Stdout, isTerminal(os.Stdout), nil}
+}
+
+// SetOutput sets where the commands print their results, stdout by default
+func (c *Cli) SetOutput(out io.Writer) {
+	c.out = out
+	c.color = false
 }
 
 func (c *Cli) Init() {
-	c.api = hnapi.NewApiClient(nil)
-	c.repo = hnapi.NewRepository(c.api, c.config)
+	c.api = hnapi.NewApiClient(nil, c.config.BaseUrl)
+	repo, err := hnapi.NewRepository(c.api, c.config)
+	if errors.Is(err, hnapi.ErrStoreLocked) {
+		utils.HandleError(fmt.Errorf("%w, running without the cache\n", err), utils.ErrorSeverityWarn)
+		repo = hnapi.NewRepositoryWithStore(c.api, c.config, hnapi.NewMemoryStore())
+	} else if err != nil {
+		c.fatal(fmt.Errorf("the cache could not be opened: %w\n", err))
+	}
+	c.repo = repo
+	c.repo.SetOffline(c.config.Offline)
+	index, err := search.Attach(repo)
+	if err != nil {
+		utils.HandleError(fmt.Errorf("the search index could not be opened: %w\n", err), utils.ErrorSeverityWarn)
+	}
+	c.index = index
+	if !c.config.NoFilter {
+		engine, err := rules.Compile(c.config.Rules)
+		if err != nil {
+			c.fatal(fmt.Errorf("invalid rules in %s: %w\n", config.GetConfigPath(), err))
+		}
+		c.rules = engine
+	}
+}
+
+// tells how old the shown data is when the repository serves only the cache
+func (c *Cli) printOfflineNotice(what string, fetchedAt time.Time) {
+	if !c.repo.IsOffline() {
+		return
+	}
+	out := c.noticeOutput()
+	if fetchedAt.IsZero() {
+		fmt.Fprintf(out, "Offline, showing the cached %s\n", what)
+		return
+	}
+	fmt.Fprintf(out, "Offline, showing the %s cached %s\n", what, utils.RelativeTime(fetchedAt))
+}
+
+// tells how many items the rules hid, out is where the notice goes
+func printHiddenNotice(out io.Writer, hidden rules.Hidden) {
+	if len(hidden) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Hidden by the rules: %s (--no-filter shows them)\n", hidden)
+}
+
+// the notices go to stderr with the structured output to keep it parsable
+func (c *Cli) noticeOutput() io.Writer {
+	if c.records != nil {
+		return os.Stderr
+	}
+	return c.out
+}
+
+/*
+fatal closes the structured output so that the records written so far stay parsable and
+the repository since the deferred calls are skipped, then prints the error and exits
+*/
+func (c *Cli) fatal(err error) {
+	c.closeRecords()
+	c.Close()
+	utils.HandleError(err, utils.ErrorSeverityFatal)
+}
+
+// terminates the structured output, e.g. closes the JSON array
+func (c *Cli) closeRecords() {
+	if c.records == nil {
+		return
+	}
+	records := c.records
+	c.records = nil
+	if err := records.Close(); err != nil {
+		c.fatal(fmt.Errorf("error while writing the output: %w\n", err))
+	}
+}
+
+// writes the record in the structured output format
+func (c *Cli) writeRecord(r record) {
+	if err := c.records.Write(r); err != nil {
+		c.fatal(fmt.Errorf("error while writing the output: %w\n", err))
+	}
 }
 
 func (c *Cli) Close() {
-	c.repo.Close()
+	if c.repo != nil {
+		c.repo.Close()
+		c.repo = nil
+	}
 }
 
-func (c *Cli) RenderStory(index int, story *hnapi.Item) string {
+// RenderStory renders the story, visit is its last visit or nil if it was never opened
+func (c *Cli) RenderStory(index int, story *hnapi.Item, visit *hnapi.Visit) string {
 	var rendered strings.Builder
+	if visit != nil && c.color {
+		rendered.WriteString(ANSI_DIM)
+	}
 	fmt.Fprintf(&rendered, "%d. %s\n", index, story.Title)
 	fmt.Fprintf(&rendered, "  url: %s \n", story.Url)
 	fmt.Fprintf(&rendered, "  date: %s | score: %d | comments: %d", time.Unix(int64(story.Time), 0).Format("2006-01-02 15:04:05"), story.Score, story.CommentsCount)
+	if newComments := visit.NewCommentsCount(story); newComments > 0 {
+		fmt.Fprintf(&rendered, " (%d new)", newComments)
+	}
+	if visit != nil && c.color {
+		rendered.WriteString(ANSI_RESET)
+	}
+	return rendered.String()
+}
+
+func (c *Cli) RenderUser(user *hnapi.User, submissions []*hnapi.Item) string {
+	var rendered strings.Builder
+	createdAt := time.Unix(int64(user.CreatedAt), 0)
+	fmt.Fprintf(&rendered, "%s\n", user.Id)
+	fmt.Fprintf(&rendered, "  karma: %d | member for %s (since %s)\n", user.Karma, utils.HumanizeDuration(time.Since(createdAt)), createdAt.Format("2006-01-02"))
+	if user.About != "" {
+		fmt.Fprintf(&rendered, "  about:\n")
+		c.renderText(&rendered, user.About, "    ", COMMENT_TEXT_WIDTH)
+	}
+	fmt.Fprintf(&rendered, "  recent submissions:")
+	for idx, item := range submissions {
+		if item == nil {
+			continue
+		}
+		date := time.Unix(int64(item.Time), 0).Format("2006-01-02 15:04:05")
+		switch item.Type {
+		case "comment":
+			text := utils.Truncate(strings.Join(strings.Fields(utils.HtmlToText(item.Text)), " "), 60)
+			fmt.Fprintf(&rendered, "\n    %d. [comment] %s\n       date: %s | parent: %d", idx+1, text, date, item.Parent)
+		default:
+			fmt.Fprintf(&rendered, "\n    %d. [%s] %s\n       date: %s | score: %d | comments: %d", idx+1, item.Type, item.Title, date, item.Score, item.CommentsCount)
+		}
+	}
+	return rendered.String()
+}
+
+/*
+RenderComments renders the story with its comments, the comments not seen in the
+previous visit are marked as new
+*/
+func (c *Cli) RenderComments(tree *hnapi.CommentNode, previousVisit *hnapi.Visit) string {
+	var rendered strings.Builder
+	story := tree.Item
+	fmt.Fprintf(&rendered, "%s\n", story.Title)
+	fmt.Fprintf(&rendered, "  %d points by %s %s | %d comments", story.Score, story.By, utils.RelativeTime(time.Unix(int64(story.Time), 0)), story.CommentsCount)
+	if newComments := previousVisit.NewCommentsCount(story); newComments > 0 {
+		fmt.Fprintf(&rendered, " (%d new since %s)", newComments, utils.RelativeTime(previousVisit.VisitedTime()))
+	}
+	rendered.WriteString("\n")
+	if story.Text != "" {
+		c.renderText(&rendered, story.Text, "  ", COMMENT_TEXT_WIDTH)
+	}
+	for _, child := range tree.Children {
+		c.renderComment(&rendered, child, previousVisit)
+	}
 	return rendered.String()
 }
 
+func (c *Cli) renderComment(rendered *strings.Builder, node *hnapi.CommentNode, previousVisit *hnapi.Visit) {
+	if node.IsRemoved() && c.config.HideDead {
+		return
+	}
+	indent := strings.Repeat(COMMENT_INDENT, node.Depth)
+	comment := node.Item
+	marker := ""
+	if previousVisit.IsNew(comment.Id) {
+		marker = "[new] "
+	}
+	switch {
+	case comment.IsDeleted:
+		fmt.Fprintf(rendered, "\n%s%s[deleted]\n", indent, marker)
+	case comment.IsDead:
+		fmt.Fprintf(rendered, "\n%s%s[dead] %s %s\n", indent, marker, comment.By, utils.RelativeTime(time.Unix(int64(comment.Time), 0)))
+	default:
+		fmt.Fprintf(rendered, "\n%s%s%s %s\n", indent, marker, comment.By, utils.RelativeTime(time.Unix(int64(comment.Time), 0)))
+		width := max(COMMENT_TEXT_WIDTH-len(indent), COMMENT_TEXT_WIDTH/2)
+		c.renderText(rendered, comment.Text, indent, width)
+	}
+	for _, child := range node.Children {
+		c.renderComment(rendered, child, previousVisit)
+	}
+}
+
+// writes the story and its comments depth first, the comments have their depth in the tree
+func (c *Cli) writeCommentRecords(node *hnapi.CommentNode) {
+	if node.IsRemoved() && c.config.HideDead {
+		return
+	}
+	c.writeRecord(NewItemRecord(node.Item, node.Depth))
+	for _, child := range node.Children {
+		c.writeCommentRecords(child)
+	}
+}
+
+// RenderItem renders any item with its details and its text
+func (c *Cli) RenderItem(item *hnapi.Item) string {
+	var rendered strings.Builder
+	switch {
+	case item.IsDeleted:
+		fmt.Fprintf(&rendered, "[deleted %s]\n", item.Type)
+	case item.Title != "":
+		fmt.Fprintf(&rendered, "%s\n", item.Title)
+	default:
+		fmt.Fprintf(&rendered, "[%s] by %s\n", item.Type, item.By)
+	}
+	fmt.Fprintf(&rendered, "  id: %d | type: %s | date: %s", item.Id, item.Type, time.Unix(int64(item.Time), 0).Format("2006-01-02 15:04:05"))
+	if item.Type == "comment" {
+		fmt.Fprintf(&rendered, " | parent: %d | replies: %d\n", item.Parent, len(item.Kids))
+	} else {
+		fmt.Fprintf(&rendered, " | score: %d | comments: %d\n", item.Score, item.CommentsCount)
+	}
+	if item.Url != "" {
+		fmt.Fprintf(&rendered, "  url: %s\n", item.Url)
+	}
+	if item.Text != "" {
+		rendered.WriteString("\n")
+		c.renderText(&rendered, item.Text, "  ", COMMENT_TEXT_WIDTH)
+	}
+	return rendered.String()
+}
+
+// renders the HTML text of an item wrapped to width, with its styles if the output is a terminal
+func (c *Cli) renderText(rendered *strings.Builder, text string, indent string, width int) {
+	for _, line := range richtext.Parse(text).Wrap(width) {
+		switch {
+		case len(line) == 0:
+			rendered.WriteString("\n")
+		case c.color:
+			fmt.Fprintf(rendered, "%s%s\n", indent, line.ANSI())
+		default:
+			fmt.Fprintf(rendered, "%s%s\n", indent, line)
+		}
+	}
+}
+
 func (c *Cli) Run() {
+	// cancels the pending requests on ctrl+c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	format := c.config.Output
+	if c.config.Template != "" && (format == "" || format == OUTPUT_TEXT) {
+		format = OUTPUT_TEMPLATE
+	}
+	if format != "" && format != OUTPUT_TEXT && !recordCommands[c.config.Command] {
+		utils.HandleError(fmt.Errorf("--output is ignored by the %s command\n", c.config.Command), utils.ErrorSeverityWarn)
+	} else if format != "" && format != OUTPUT_TEXT {
+		records, err := newRecordWriter(c.out, format, c.config.Template)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		c.records = records
+		defer c.closeRecords()
+	}
 	switch c.config.Command {
 	case "top":
 		c.Init()
-		topStories, err := c.api.GetTopStoryIds()
+		feed, err := hnapi.ParseFeed(c.config.Feed)
 		if err != nil {
-			fmt.Println(err)
+			c.fatal(fmt.Errorf("%w\n", err))
 		}
-		storiesCount := min(len(topStories), c.config.StoryCount)
-		stories, err := c.repo.GetItems(topStories[:storiesCount])
+		cachedFeed, err := c.repo.GetFeed(ctx, feed)
 		if err != nil {
-			utils.HandleError(err, utils.ErrorSeverityFatal)
+			c.fatal(fmt.Errorf("%w\n", err))
 		}
-		for idx, story := range stories {
+		c.printOfflineNotice(feed.String()+" stories", cachedFeed.FetchedTime())
+		hidden := rules.Hidden{}
+		for result := range c.rules.StreamStories(ctx, c.repo, cachedFeed.Ids, c.config.StoryCount, hidden) {
+			if result.Err != nil {
+				utils.HandleError(fmt.Errorf("story %d could not be loaded: %w\n", result.Id, result.Err), utils.ErrorSeverityWarn)
+				continue
+			}
+			visit, err := c.repo.LoadVisit(result.Id)
 			if err != nil {
-				fmt.Println(err)
+				utils.HandleError(fmt.Errorf("the visit of story %d could not be loaded: %w\n", result.Id, err), utils.ErrorSeverityWarn)
+			}
+			if c.records != nil {
+				c.writeRecord(NewItemRecord(result.Item, 0))
 				continue
 			}
-			fmt.Printf("--------------------------------\n%s\n", c.RenderStory(idx+1, story))
+			fmt.Fprintf(c.out, "--------------------------------\n%s\n", c.RenderStory(result.Index+1, result.Item, visit))
+		}
+		printHiddenNotice(c.noticeOutput(), hidden)
+	case "item":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing item id, usage: item <id>\n"))
+		}
+		id, err := strconv.Atoi(c.config.Args[0])
+		if err != nil {
+			c.fatal(fmt.Errorf("invalid item id \"%s\"\n", c.config.Args[0]))
+		}
+		c.Init()
+		item, err := c.repo.GetItem(ctx, id)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		if cached, cacheErr := c.repo.LoadItemFromCache(id); cacheErr == nil {
+			c.printOfflineNotice("item", cached.FetchedTime())
+		}
+		if c.records != nil {
+			c.writeRecord(NewItemRecord(item, 0))
+			break
+		}
+		fmt.Fprint(c.out, c.RenderItem(item))
+	case "user":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing user name, usage: user <name>\n"))
+		}
+		c.Init()
+		user, err := c.repo.GetUser(ctx, c.config.Args[0])
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		c.printOfflineNotice("profile of "+user.Id, time.Time{})
+		if c.records != nil {
+			c.writeRecord(NewUserRecord(user))
+			break
+		}
+		submissionsCount := min(len(user.Submitted), c.config.StoryCount)
+		submissions, err := c.repo.GetItems(ctx, user.Submitted[:submissionsCount])
+		if submissions == nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		fmt.Fprintln(c.out, c.RenderUser(user, submissions))
+		if err != nil {
+			utils.HandleError(fmt.Errorf("some submissions could not be loaded: %w\n", err), utils.ErrorSeverityWarn)
+		}
+	case "comments":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing story id, usage: comments <id>\n"))
+		}
+		storyId, err := strconv.Atoi(c.config.Args[0])
+		if err != nil {
+			c.fatal(fmt.Errorf("invalid story id \"%s\"\n", c.config.Args[0]))
+		}
+		c.Init()
+		tree, err := c.repo.GetCommentTree(ctx, storyId, c.config.Depth)
+		if tree == nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		if cached, cacheErr := c.repo.LoadItemFromCache(storyId); cacheErr == nil {
+			c.printOfflineNotice("comments", cached.FetchedTime())
+		}
+		previousVisit, visitErr := c.repo.MarkVisited(tree)
+		if visitErr != nil {
+			utils.HandleError(fmt.Errorf("the visit could not be recorded: %w\n", visitErr), utils.ErrorSeverityWarn)
+		}
+		hidden := rules.Hidden{}
+		c.rules.FilterTree(tree, hidden)
+		if c.records != nil {
+			c.writeCommentRecords(tree)
+		} else {
+			fmt.Fprint(c.out, c.RenderComments(tree, previousVisit))
+		}
+		printHiddenNotice(c.noticeOutput(), hidden)
+		if err != nil {
+			utils.HandleError(fmt.Errorf("some comments could not be loaded: %w\n", err), utils.ErrorSeverityWarn)
+		}
+	case "sync":
+		c.Init()
+		feedNames := c.config.Args
+		if len(feedNames) == 0 {
+			feedNames = []string{c.config.Feed}
+		}
+		feeds := make([]hnapi.Feed, 0, len(feedNames))
+		for _, name := range feedNames {
+			feed, err := hnapi.ParseFeed(name)
+			if err != nil {
+				c.fatal(fmt.Errorf("%w\n", err))
+			}
+			feeds = append(feeds, feed)
+		}
+		options := hnapi.SyncOptions{Feeds: feeds, StoryCount: c.config.StoryCount, Depth: c.config.Depth, Concurrency: c.config.Concurrency}
+		report, err := c.repo.Sync(ctx, options, c.printSyncProgress)
+		if isTerminal(os.Stderr) {
+			fmt.Fprintln(os.Stderr)
+		}
+		if report == nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		fmt.Fprint(c.out, c.RenderSyncReport(report))
+		if err != nil {
+			utils.HandleError(fmt.Errorf("sync interrupted, run it again to resume: %w\n", err), utils.ErrorSeverityWarn)
+		}
+	case "save", "unsave":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing item id, usage: %s <id>\n", c.config.Command))
+		}
+		id, err := strconv.Atoi(c.config.Args[0])
+		if err != nil {
+			c.fatal(fmt.Errorf("invalid item id \"%s\"\n", c.config.Args[0]))
+		}
+		c.Init()
+		if c.config.Command == "unsave" {
+			if err := c.repo.Unsave(id); err != nil {
+				c.fatal(fmt.Errorf("%w\n", err))
+			}
+			fmt.Fprintf(c.out, "unsaved %d\n", id)
+			break
+		}
+		saved, err := c.repo.Save(ctx, id, c.config.Tags, c.config.Note)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		fmt.Fprintf(c.out, "saved %d", id)
+		if len(saved.Tags) > 0 {
+			fmt.Fprintf(c.out, " [%s]", strings.Join(saved.Tags, ", "))
+		}
+		fmt.Fprintln(c.out)
+	case "saved":
+		c.Init()
+		savedItems, err := c.repo.SavedItems(c.config.Tags...)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		ids := make([]int, len(savedItems))
+		for i, saved := range savedItems {
+			ids[i] = saved.Id
+		}
+		items, err := c.repo.GetItems(ctx, ids)
+		if items == nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		if c.records != nil {
+			for i, saved := range savedItems {
+				c.writeRecord(NewSavedRecord(saved, items[i]))
+			}
+		} else {
+			fmt.Fprint(c.out, c.RenderSaved(savedItems, items))
+		}
+		if err != nil {
+			utils.HandleError(fmt.Errorf("some saved items could not be loaded: %w\n", err), utils.ErrorSeverityWarn)
+		}
+	case "search":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing query, usage: search [--remote] <words> [\"phrase\"] [by:user] [type:story] [score>n] [after:yyyy-mm-dd]\n"))
+		}
+		query, err := search.ParseQuery(strings.Join(c.config.Args, " "))
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		if c.config.Remote {
+			c.searchRemote(ctx, query)
+			break
 		}
+		c.Init()
+		if c.index == nil {
+			c.fatal(fmt.Errorf("the search index is not available\n"))
+		}
+		if err := c.index.WaitRebuilt(ctx); err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		results, err := c.index.Search(query, c.config.StoryCount)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		c.printSearchResults(results, 1)
+	case "feed":
+		if len(c.config.Args) == 0 || c.config.Args[0] != "export" {
+			c.fatal(fmt.Errorf("usage: feed export [file] [--format rss|atom] [--min-score n] [--domain d] [--keyword k]\n"))
+		}
+		c.Init()
+		c.exportFeed(ctx, c.config.Args[1:])
+	case "serve":
+		c.Init()
+		c.serve(ctx)
+	case "cache":
+		if len(c.config.Args) == 0 {
+			c.fatal(fmt.Errorf("missing subcommand, usage: cache stats|gc|export [file]|import [file]\n"))
+		}
+		c.Init()
+		c.runCache(c.config.Args[0], c.config.Args[1:])
 	default:
 
 	}
 }
+
+/*
+exportFeed writes the filtered stories of the feed, or the saved items, as an RSS or Atom feed
+to the file or to the output. The file is replaced at once so the feed readers never read a
+partially written feed.
+*/
+func (c *Cli) exportFeed(ctx context.Context, args []string) {
+	format, err := syndication.ParseFormat(c.config.FeedFormat)
+	if err != nil {
+		c.fatal(fmt.Errorf("%w\n", err))
+	}
+	var ids []int
+	channel := syndication.Channel{Link: hnapi.HN_URL}
+	if c.config.Feed == "saved" {
+		savedItems, err := c.repo.SavedItems(c.config.Tags...)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		for _, saved := range savedItems {
+			ids = append(ids, saved.Id)
+		}
+		channel.Title = "Hacker News: saved items"
+		if len(c.config.Tags) > 0 {
+			channel.Title += " tagged " + strings.Join(c.config.Tags, ", ")
+		}
+	} else {
+		feed, err := hnapi.ParseFeed(c.config.Feed)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		cachedFeed, err := c.repo.GetFeed(ctx, feed)
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		ids = cachedFeed.Ids[:min(len(cachedFeed.Ids), c.config.StoryCount)]
+		channel.Title = fmt.Sprintf("Hacker News: %s stories", feed)
+		channel.Link = syndication.FeedUrl(feed)
+	}
+	items, err := c.repo.GetItems(ctx, ids)
+	if items == nil {
+		c.fatal(fmt.Errorf("%w\n", err))
+	}
+	if err != nil {
+		utils.HandleError(fmt.Errorf("some items could not be loaded: %w\n", err), utils.ErrorSeverityWarn)
+	}
+	filter := syndication.Filter{MinScore: c.config.MinScore, Domains: c.config.Domains, Keywords: c.config.Keywords}
+	channel.Description = channel.Title
+	if description := filter.String(); description != "" {
+		channel.Description += " (" + description + ")"
+	}
+	hidden := rules.Hidden{}
+	items = filter.Apply(c.rules.Filter(items, hidden))
+	write := func(w io.Writer) error {
+		return syndication.Write(w, format, channel, items)
+	}
+	if len(args) == 0 || args[0] == "-" {
+		if err := write(c.out); err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		printHiddenNotice(os.Stderr, hidden) // keeps the feed parsable
+		return
+	}
+	if err := writeFileAtomically(args[0], write); err != nil {
+		c.fatal(fmt.Errorf("the feed could not be written: %w\n", err))
+	}
+	fmt.Fprintf(c.out, "exported %d items to %s\n", len(items), args[0])
+	printHiddenNotice(c.out, hidden)
+}
+
+// writes the file to a temporary file next to it then renames it over the file
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails once renamed
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+/*
+serve serves the cache over HTTP on the configured address until ctx is done, the pending
+requests are given SERVE_SHUTDOWN_TIMEOUT to complete
+*/
+func (c *Cli) serve(ctx context.Context) {
+	listener, err := net.Listen("tcp", c.config.Addr)
+	if err != nil {
+		c.fatal(fmt.Errorf("%w\n", err))
+	}
+	httpServer := &http.Server{
+		Handler:           server.New(c.repo, c.index),
+		ReadHeaderTimeout: SERVE_READ_HEADER_TIMEOUT,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+	fmt.Fprintf(c.out, "serving the cache on http://%s/v0/ and http://%s/api/, press ctrl+c to stop\n", listener.Addr(), listener.Addr())
+	select {
+	case err := <-errs:
+		c.fatal(fmt.Errorf("%w\n", err))
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SERVE_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		utils.HandleError(fmt.Errorf("the server did not stop cleanly: %w\n", err), utils.ErrorSeverityWarn)
+	}
+}
+
+func (c *Cli) runCache(subcommand string, args []string) {
+	switch subcommand {
+	case "stats":
+		stats, err := c.repo.CacheStats()
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		fmt.Fprint(c.out, c.RenderCacheStats(stats))
+	case "gc":
+		report, err := c.repo.GC(hnapi.GCOptions{MaxAge: c.config.MaxAge, Unlinked: c.config.Unlinked})
+		if err != nil {
+			c.fatal(fmt.Errorf("%w\n", err))
+		}
+		removed := fmt.Sprintf("fetched more than %s ago", utils.HumanizeDuration(c.config.MaxAge))
+		if c.config.Unlinked {
+			removed = "not linked to a saved item"
+		}
+		fmt.Fprintf(c.out, "removed %d items %s, %s -> %s\n", report.Removed, removed,
+			utils.HumanizeBytes(report.SizeBefore), utils.HumanizeBytes(report.SizeAfter))
+	case "export":
+		out := c.out
+		if len(args) > 0 && args[0] != "-" {
+			file, err := os.Create(args[0])
+			if err != nil {
+				c.fatal(fmt.Errorf("%w\n", err))
+			}
+			defer file.Close()
+			out = file
+		}
+		count, err := c.repo.Export(out)
+		if err != nil {
+			c.fatal(fmt.Errorf("the export failed after %d records: %w\n", count, err))
+		}
+		if out != c.out {
+			fmt.Fprintf(c.out, "exported %d records to %s\n", count, args[0])
+		}
+	case "import":
+		var in io.Reader = os.Stdin
+		if len(args) > 0 && args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				c.fatal(fmt.Errorf("%w\n", err))
+			}
+			defer file.Close()
+			in = file
+		}
+		report, err := c.repo.Import(in)
+		if err != nil {
+			c.fatal(fmt.Errorf("the import failed after %d records: %w\n", report.Imported, err))
+		}
+		fmt.Fprintf(c.out, "imported %d records, skipped %d items cached more recently\n", report.Imported, report.Skipped)
+	default:
+		c.fatal(fmt.Errorf("unknown cache subcommand \"%s\", usage: cache stats|gc|export [file]|import [file]\n", subcommand))
+	}
+}
+
+/*
+RenderSaved renders the saved items with their tags and notes, items holds the saved
+items in the same order, nil for the ones that could not be loaded
+*/
+func (c *Cli) RenderSaved(savedItems []*hnapi.SavedItem, items []*hnapi.Item) string {
+	var rendered strings.Builder
+	if len(savedItems) == 0 {
+		rendered.WriteString("no saved items\n")
+	}
+	for i, saved := range savedItems {
+		title := fmt.Sprintf("item %d", saved.Id)
+		if item := items[i]; item != nil {
+			switch {
+			case item.Title != "":
+				title = item.Title
+			case item.Text != "":
+				title = fmt.Sprintf("[%s] %s", item.Type, utils.Truncate(strings.TrimSpace(utils.HtmlToText(item.Text)), 60))
+			}
+		}
+		fmt.Fprintf(&rendered, "%d. %s\n", i+1, title)
+		fmt.Fprintf(&rendered, "  id: %d | saved %s", saved.Id, utils.RelativeTime(saved.SavedTime()))
+		if len(saved.Tags) > 0 {
+			fmt.Fprintf(&rendered, " | tags: %s", strings.Join(saved.Tags, ", "))
+		}
+		rendered.WriteString("\n")
+		if saved.Note != "" {
+			fmt.Fprintf(&rendered, "  note: %s\n", saved.Note)
+		}
+	}
+	return rendered.String()
+}
+
+// searches the query with the search API, for the items that are not cached
+func (c *Cli) searchRemote(ctx context.Context, query *search.Query) {
+	if c.config.Offline {
+		c.fatal(fmt.Errorf("the remote search needs the network, search without --remote to search the cache\n"))
+	}
+	request := query.SearchRequest()
+	request.Page = max(c.config.Page, 1) - 1
+	request.HitsPerPage = c.config.StoryCount
+	response, err := hnapi.NewSearchClient(nil, c.config.SearchUrl).Search(ctx, request)
+	if err != nil {
+		c.fatal(fmt.Errorf("%w\n", err))
+	}
+	results := make([]search.Result, len(response.Hits))
+	for i, hit := range response.Hits {
+		results[i] = search.Result{Item: hit.Item()}
+	}
+	if len(results) > 0 && c.records == nil {
+		fmt.Fprintf(c.out, "%d matching items, page %d of %d\n", response.HitsCount, response.Page+1, response.Pages)
+	}
+	c.printSearchResults(results, response.Page*response.HitsPerPage+1)
+}
+
+func (c *Cli) printSearchResults(results []search.Result, firstIndex int) {
+	if c.records == nil {
+		fmt.Fprint(c.out, c.RenderSearchResults(results, firstIndex))
+		return
+	}
+	for _, result := range results {
+		c.writeRecord(NewItemRecord(result.Item, 0))
+	}
+}
+
+// RenderSearchResults renders the matching items numbered from firstIndex, the most relevant first
+func (c *Cli) RenderSearchResults(results []search.Result, firstIndex int) string {
+	var rendered strings.Builder
+	if len(results) == 0 {
+		rendered.WriteString("no matching items\n")
+	}
+	for i, result := range results {
+		item := result.Item
+		date := time.Unix(int64(item.Time), 0).Format("2006-01-02 15:04:05")
+		switch item.Type {
+		case "comment":
+			text := utils.Truncate(strings.Join(strings.Fields(utils.HtmlToText(item.Text)), " "), 60)
+			fmt.Fprintf(&rendered, "%d. [comment] %s\n", firstIndex+i, text)
+			fmt.Fprintf(&rendered, "  id: %d | by: %s | date: %s | parent: %d\n", item.Id, item.By, date, item.Parent)
+		default:
+			fmt.Fprintf(&rendered, "%d. %s\n", firstIndex+i, item.Title)
+			fmt.Fprintf(&rendered, "  id: %d | by: %s | date: %s | score: %d | comments: %d\n", item.Id, item.By, date, item.Score, item.CommentsCount)
+		}
+	}
+	return rendered.String()
+}
+
+func (c *Cli) RenderCacheStats(stats *hnapi.CacheStats) string {
+	var rendered strings.Builder
+	fmt.Fprintf(&rendered, "cache: %s\n", c.config.DbPath)
+	fmt.Fprintf(&rendered, "  size: %s\n", utils.HumanizeBytes(stats.Size))
+	fmt.Fprintf(&rendered, "  items: %d", stats.Items)
+	if stats.Items > 0 {
+		fmt.Fprintf(&rendered, " (fetched %s to %s)", utils.RelativeTime(stats.OldestItem), utils.RelativeTime(stats.NewestItem))
+	}
+	fmt.Fprintf(&rendered, "\n  users: %d\n  feeds: %d\n  visited stories: %d\n  saved items: %d\n", stats.Users, stats.Feeds, stats.Visits, stats.Saved)
+	return rendered.String()
+}
+
+// overwrites the progress line on stderr if it is a terminal
+func (c *Cli) printSyncProgress(progress hnapi.SyncProgress) {
+	if !isTerminal(os.Stderr) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\rsyncing: %d/%d stories, %d items, %d users, %d errors", progress.StoriesDone, progress.StoriesTotal, progress.Items, progress.Users, progress.Errors)
+}
+
+func (c *Cli) RenderSyncReport(report *hnapi.SyncReport) string {
+	var rendered strings.Builder
+	fmt.Fprintf(&rendered, "synced %d stories of %d feed(s) in %s\n", report.Stories, report.Feeds, report.Duration.Round(time.Millisecond))
+	if report.Resumed > 0 {
+		fmt.Fprintf(&rendered, "  resumed: %d stories were synced by the interrupted run\n", report.Resumed)
+	}
+	fmt.Fprintf(&rendered, "  items: %d | users: %d | errors: %d\n", report.Items, report.Users, len(report.Errors))
+	for _, err := range report.Errors {
+		fmt.Fprintf(&rendered, "  error: %v\n", err)
+	}
+	return rendered.String()
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
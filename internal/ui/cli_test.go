@@ -0,0 +1,270 @@
+package ui
+
+import (
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/hnapi/hntest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runCli(t *testing.T, cfg config.Config) string {
+	server := hntest.NewServerWithFixtures()
+	t.Cleanup(server.Close)
+	if cfg.DbPath == "" {
+		cfg.DbPath = t.TempDir()
+	}
+	cfg.BaseUrl = server.BaseUrl()
+	cfg.SearchUrl = server.SearchUrl()
+	cli := NewCli(&cfg)
+	var out strings.Builder
+	cli.SetOutput(&out)
+	cli.Run()
+	cli.Close()
+	return out.String()
+}
+
+func Test_Cli_Top(t *testing.T) {
+	out := runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10})
+	first := strings.Index(out, "1. Go 1.25 released")
+	second := strings.Index(out, "2. Show HN: A terminal reader for Hacker News")
+	if first == -1 || second == -1 || first > second {
+		t.Errorf("Expected the best stories in order, got:\n%s", out)
+	}
+	if strings.Contains(out, "Ask HN") {
+		t.Errorf("Expected only the best stories, got:\n%s", out)
+	}
+}
+
+func Test_Cli_User(t *testing.T) {
+	out := runCli(t, config.Config{Command: "user", Args: []string{"alice"}, StoryCount: 10})
+	for _, expected := range []string{"karma: 4321", "Say hi: alice@example.com", "[comment] Thanks, both are on the roadmap.", "[story] Show HN"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the output to contain \"%s\", got:\n%s", expected, out)
+		}
+	}
+}
+
+func Test_Cli_Comments(t *testing.T) {
+	out := runCli(t, config.Config{Command: "comments", Args: []string{"100"}})
+	for _, expected := range []string{"bob ", "I'd love vim key bindings.", "[deleted]", "\n    alice ", "[dead] spammer"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the output to contain \"%s\", got:\n%s", expected, out)
+		}
+	}
+
+	out = runCli(t, config.Config{Command: "comments", Args: []string{"100"}, HideDead: true})
+	if strings.Contains(out, "[deleted]") || strings.Contains(out, "[dead]") {
+		t.Errorf("Expected the removed comments to be hidden, got:\n%s", out)
+	}
+}
+
+func Test_Cli_Offline(t *testing.T) {
+	dbPath := t.TempDir()
+	runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 1, DbPath: dbPath})
+	out := runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10, DbPath: dbPath, Offline: true})
+	if !strings.Contains(out, "Offline, showing the best stories cached ") {
+		t.Errorf("Expected the offline notice, got:\n%s", out)
+	}
+	if !strings.Contains(out, "1. Go 1.25 released") {
+		t.Errorf("Expected the cached story, got:\n%s", out)
+	}
+}
+
+func Test_Cli_Sync(t *testing.T) {
+	dbPath := t.TempDir()
+	out := runCli(t, config.Config{Command: "sync", Args: []string{"top"}, StoryCount: 2, DbPath: dbPath})
+	if !strings.Contains(out, "synced 2 stories of 1 feed(s)") {
+		t.Errorf("Expected the sync report, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "comments", Args: []string{"100"}, DbPath: dbPath, Offline: true})
+	if !strings.Contains(out, "Offline, showing the comments cached ") || !strings.Contains(out, "I'd love vim key bindings.") {
+		t.Errorf("Expected the synced comments offline, got:\n%s", out)
+	}
+}
+
+func Test_Cli_CacheExportImport(t *testing.T) {
+	dbPath := t.TempDir()
+	exportPath := t.TempDir() + "/export.jsonl"
+	// the comments are exported along with the visit of the story
+	runCli(t, config.Config{Command: "comments", Args: []string{"100"}, DbPath: dbPath})
+	out := runCli(t, config.Config{Command: "cache", Args: []string{"export", exportPath}, DbPath: dbPath})
+	if !strings.Contains(out, "exported 6 records") {
+		t.Errorf("Expected the export summary, got:\n%s", out)
+	}
+
+	importedPath := t.TempDir()
+	out = runCli(t, config.Config{Command: "cache", Args: []string{"import", exportPath}, DbPath: importedPath})
+	if !strings.Contains(out, "imported 6 records") {
+		t.Errorf("Expected the import summary, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "cache", Args: []string{"stats"}, DbPath: importedPath})
+	if !strings.Contains(out, "items: 5 (fetched ") || !strings.Contains(out, "visited stories: 1") {
+		t.Errorf("Expected the stats of the imported cache, got:\n%s", out)
+	}
+}
+
+func Test_Cli_CacheExportIgnoresOutput(t *testing.T) {
+	dbPath := t.TempDir()
+	runCli(t, config.Config{Command: "item", Args: []string{"200"}, DbPath: dbPath})
+	out := runCli(t, config.Config{Command: "cache", Args: []string{"export"}, DbPath: dbPath, Output: OUTPUT_JSON})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 0 || strings.Contains(out, "[]") {
+		t.Fatalf("Expected only the exported records, got:\n%s", out)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "{") {
+			t.Errorf("Expected every line to be a record, got \"%s\"", line)
+		}
+	}
+}
+
+func Test_Cli_MarksNewComments(t *testing.T) {
+	server := hntest.NewServerWithFixtures()
+	defer server.Close()
+	cfg := config.Config{Command: "comments", Args: []string{"100"}, DbPath: t.TempDir(), BaseUrl: server.BaseUrl()}
+	run := func(cfg config.Config) string {
+		cli := NewCli(&cfg)
+		var out strings.Builder
+		cli.SetOutput(&out)
+		cli.Run()
+		cli.Close()
+		return out.String()
+	}
+	if out := run(cfg); strings.Contains(out, "[new]") {
+		t.Errorf("Expected nothing new on the first visit, got:\n%s", out)
+	}
+
+	story, _ := server.Item(100)
+	story.Kids = append(story.Kids, 105)
+	story.CommentsCount++
+	server.AddItems(story, hnapi.Item{Id: 105, By: "carol", Parent: 100, Text: "A late comment", Type: "comment"})
+	// the old stories are never refetched, the gc removes them but keeps the visits
+	run(config.Config{Command: "cache", Args: []string{"gc"}, MaxAge: time.Nanosecond, DbPath: cfg.DbPath})
+
+	out := run(cfg)
+	if !strings.Contains(out, "(1 new since ") || !strings.Contains(out, "[new] carol") || strings.Contains(out, "[new] bob") {
+		t.Errorf("Expected only the comment of carol to be new, got:\n%s", out)
+	}
+	top := run(config.Config{Command: "top", Feed: "top", StoryCount: 1, DbPath: cfg.DbPath, BaseUrl: server.BaseUrl()})
+	if strings.Contains(top, "new)") {
+		t.Errorf("Expected no new comments after the visit, got:\n%s", top)
+	}
+}
+
+func Test_Cli_Saved(t *testing.T) {
+	dbPath := t.TempDir()
+	if out := runCli(t, config.Config{Command: "saved", DbPath: dbPath}); !strings.Contains(out, "no saved items") {
+		t.Errorf("Expected no saved items, got:\n%s", out)
+	}
+	out := runCli(t, config.Config{Command: "save", Args: []string{"100"}, Tags: []string{"Go", "tui"}, Note: "try it", DbPath: dbPath})
+	if !strings.Contains(out, "saved 100 [go, tui]") {
+		t.Errorf("Expected the saved item, got:\n%s", out)
+	}
+	runCli(t, config.Config{Command: "save", Args: []string{"101"}, DbPath: dbPath})
+
+	out = runCli(t, config.Config{Command: "saved", Tags: []string{"go"}, DbPath: dbPath})
+	for _, expected := range []string{"1. Show HN: A terminal reader for Hacker News", "tags: go, tui", "note: try it"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the output to contain \"%s\", got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "[comment]") {
+		t.Errorf("Expected only the items tagged go, got:\n%s", out)
+	}
+
+	runCli(t, config.Config{Command: "unsave", Args: []string{"100"}, DbPath: dbPath})
+	out = runCli(t, config.Config{Command: "saved", DbPath: dbPath})
+	if !strings.Contains(out, "1. [comment] Looks great!") || strings.Contains(out, "Show HN") {
+		t.Errorf("Expected only the saved comment, got:\n%s", out)
+	}
+}
+
+func Test_Cli_Search(t *testing.T) {
+	dbPath := t.TempDir()
+	runCli(t, config.Config{Command: "comments", Args: []string{"100"}, DbPath: dbPath})
+	runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10, DbPath: dbPath})
+
+	// the cached items are searched without the network
+	out := runCli(t, config.Config{Command: "search", Args: []string{"hacker", "news"}, StoryCount: 10, Offline: true, DbPath: dbPath})
+	if !strings.Contains(out, "1. Show HN: A terminal reader for Hacker News") || strings.Contains(out, "Go 1.25") {
+		t.Errorf("Expected only the matching story, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "search", Args: []string{`"key bindings"`, "type:comment"}, StoryCount: 10, Offline: true, DbPath: dbPath})
+	if !strings.Contains(out, "1. [comment] Looks great!") || !strings.Contains(out, "by: bob") {
+		t.Errorf("Expected the comment with the phrase, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "search", Args: []string{"score>200"}, StoryCount: 10, Offline: true, DbPath: dbPath})
+	if !strings.Contains(out, "1. Go 1.25 released") || strings.Contains(out, "terminal reader") {
+		t.Errorf("Expected only the story with more than 200 points, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "search", Args: []string{"python"}, StoryCount: 10, Offline: true, DbPath: dbPath})
+	if !strings.Contains(out, "no matching items") {
+		t.Errorf("Expected no matching items, got:\n%s", out)
+	}
+}
+
+func Test_Cli_SearchRemote(t *testing.T) {
+	out := runCli(t, config.Config{Command: "search", Args: []string{"type:story"}, Remote: true, StoryCount: 2, Page: 2})
+	if !strings.Contains(out, "3 matching items, page 2 of 2") || !strings.Contains(out, "3. Show HN: A terminal reader for Hacker News") {
+		t.Errorf("Expected the last page of the stories, got:\n%s", out)
+	}
+	out = runCli(t, config.Config{Command: "search", Args: []string{"roadmap", "by:alice"}, Remote: true, StoryCount: 10, Page: 1})
+	if !strings.Contains(out, "1. [comment] Thanks, both are on the roadmap.") {
+		t.Errorf("Expected the comment of alice, got:\n%s", out)
+	}
+}
+
+func Test_Cli_FeedExport(t *testing.T) {
+	dbPath := t.TempDir()
+	path := filepath.Join(t.TempDir(), "top.xml")
+	out := runCli(t, config.Config{Command: "feed", Args: []string{"export", path}, Feed: "top", StoryCount: 10, FeedFormat: "rss", MinScore: 100, DbPath: dbPath})
+	if !strings.Contains(out, "exported 2 items to "+path) {
+		t.Errorf("Expected the 2 stories with at least 100 points, got:\n%s", out)
+	}
+	exported, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the feed file, got %v", err)
+	}
+	if !strings.Contains(string(exported), "<title>Go 1.25 released</title>") || strings.Contains(string(exported), "Ask HN") {
+		t.Errorf("Expected the filtered stories in the feed, got:\n%s", exported)
+	}
+
+	runCli(t, config.Config{Command: "save", Args: []string{"300"}, DbPath: dbPath})
+	out = runCli(t, config.Config{Command: "feed", Args: []string{"export"}, Feed: "saved", FeedFormat: "atom", Keywords: []string{"read"}, DbPath: dbPath})
+	if !strings.Contains(out, "<title>Hacker News: saved items</title>") || !strings.Contains(out, "<title>Ask HN: How do you read Hacker News?</title>") {
+		t.Errorf("Expected the saved items as an Atom feed, got:\n%s", out)
+	}
+}
+
+func Test_Cli_TopRules(t *testing.T) {
+	rules := []config.RuleConfig{{Name: "no go", Domains: []string{"go.dev"}}}
+	out := runCli(t, config.Config{Command: "top", Feed: "top", StoryCount: 2, Rules: rules})
+	if strings.Contains(out, "Go 1.25 released") {
+		t.Errorf("Expected the go.dev story to be hidden, got:\n%s", out)
+	}
+	for _, expected := range []string{"1. Show HN", "2. Ask HN", `Hidden by the rules: 1 by "no go"`} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the output to contain \"%s\", got:\n%s", expected, out)
+		}
+	}
+
+	out = runCli(t, config.Config{Command: "top", Feed: "top", StoryCount: 2, Rules: rules, NoFilter: true})
+	if !strings.Contains(out, "2. Go 1.25 released") || strings.Contains(out, "Hidden") {
+		t.Errorf("Expected --no-filter to show every story, got:\n%s", out)
+	}
+}
+
+func Test_Cli_CommentsRules(t *testing.T) {
+	rules := []config.RuleConfig{{Authors: []string{"bob"}, Items: "comments"}}
+	out := runCli(t, config.Config{Command: "comments", Args: []string{"100"}, Rules: rules})
+	if strings.Contains(out, "vim key bindings") || strings.Contains(out, "on the roadmap") {
+		t.Errorf("Expected the comment of bob to be hidden with its replies, got:\n%s", out)
+	}
+	if !strings.Contains(out, `Hidden by the rules: 1 by "by bob"`) {
+		t.Errorf("Expected the hidden comments to be counted, got:\n%s", out)
+	}
+}
@@ -0,0 +1,283 @@
+package ui
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hnterminal/internal/hnapi"
+	"hnterminal/internal/richtext"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	OUTPUT_TEXT     = "text"
+	OUTPUT_JSON     = "json"
+	OUTPUT_NDJSON   = "ndjson"
+	OUTPUT_CSV      = "csv"
+	OUTPUT_MARKDOWN = "markdown"
+	OUTPUT_TEMPLATE = "template"
+)
+
+var OutputFormats = [...]string{OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_NDJSON, OUTPUT_CSV, OUTPUT_MARKDOWN, OUTPUT_TEMPLATE}
+
+// the commands writing their results as records, the others always write text
+var recordCommands = map[string]bool{"top": true, "item": true, "comments": true, "user": true, "search": true, "saved": true}
+
+/*
+ItemRecord is an item in the structured outputs, the field names are stable.
+The text is converted from HTML to plain text, Depth is the depth of the comments in a tree.
+*/
+type ItemRecord struct {
+	Id       int    `json:"id"`
+	Type     string `json:"type"`
+	By       string `json:"by"`
+	Time     int    `json:"time"` // unix time
+	Title    string `json:"title"`
+	Url      string `json:"url"`
+	Text     string `json:"text"`
+	Score    int    `json:"score"`
+	Comments int    `json:"comments"`
+	Parent   int    `json:"parent"`
+	Kids     []int  `json:"kids"`
+	Depth    int    `json:"depth"`
+	Dead     bool   `json:"dead"`
+	Deleted  bool   `json:"deleted"`
+	HnUrl    string `json:"hn_url"`
+}
+
+func NewItemRecord(item *hnapi.Item, depth int) *ItemRecord {
+	kids := []int(item.Kids)
+	if kids == nil {
+		kids = []int{}
+	}
+	return &ItemRecord{
+		Id:       item.Id,
+		Type:     item.Type,
+		By:       item.By,
+		Time:     item.Time,
+		Title:    item.Title,
+		Url:      item.Url,
+		Text:     richtext.Parse(item.Text).PlainText(),
+		Score:    item.Score,
+		Comments: item.CommentsCount,
+		Parent:   item.Parent,
+		Kids:     kids,
+		Depth:    depth,
+		Dead:     item.IsDead,
+		Deleted:  item.IsDeleted,
+		HnUrl:    hnapi.HN_ITEM_URL + strconv.Itoa(item.Id),
+	}
+}
+
+// the item as a markdown list item, the comments are nested by their depth
+func (r *ItemRecord) markdown() string {
+	indent := strings.Repeat("  ", r.Depth)
+	switch {
+	case r.Deleted:
+		return fmt.Sprintf("%s- [deleted]\n", indent)
+	case r.Type == "comment":
+		text := strings.ReplaceAll(r.Text, "\n\n", "\n"+indent+"  ")
+		return fmt.Sprintf("%s- **%s** ([link](%s)): %s\n", indent, r.By, r.HnUrl, text)
+	}
+	title := r.Title
+	if r.Url != "" {
+		title = fmt.Sprintf("[%s](%s)", r.Title, r.Url)
+	}
+	return fmt.Sprintf("%s- %s - %d points by %s, [%d comments](%s)\n", indent, title, r.Score, r.By, r.Comments, r.HnUrl)
+}
+
+/*
+UserRecord is a user profile in the structured outputs, the field names are stable
+*/
+type UserRecord struct {
+	Id        string `json:"id"`
+	Created   int    `json:"created"` // unix time
+	Karma     int    `json:"karma"`
+	About     string `json:"about"`
+	Submitted []int  `json:"submitted"`
+	HnUrl     string `json:"hn_url"`
+}
+
+func NewUserRecord(user *hnapi.User) *UserRecord {
+	submitted := []int(user.Submitted)
+	if submitted == nil {
+		submitted = []int{}
+	}
+	return &UserRecord{user.Id, user.CreatedAt, user.Karma, richtext.Parse(user.About).PlainText(), submitted, hnapi.HN_USER_URL + user.Id}
+}
+
+func (r *UserRecord) markdown() string {
+	created := time.Unix(int64(r.Created), 0).Format("2006-01-02")
+	rendered := fmt.Sprintf("- [%s](%s) - %d karma, member since %s\n", r.Id, r.HnUrl, r.Karma, created)
+	if r.About != "" {
+		rendered += "  " + strings.ReplaceAll(r.About, "\n\n", "\n  ") + "\n"
+	}
+	return rendered
+}
+
+/*
+SavedRecord is a saved item with its tags and note in the structured outputs
+*/
+type SavedRecord struct {
+	ItemRecord
+	SavedAt int64    `json:"saved_at"` // unix time
+	Tags    []string `json:"tags"`
+	Note    string   `json:"note"`
+}
+
+func NewSavedRecord(saved *hnapi.SavedItem, item *hnapi.Item) *SavedRecord {
+	if item == nil { // the item could not be loaded
+		item = &hnapi.Item{Id: saved.Id}
+	}
+	tags := saved.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return &SavedRecord{*NewItemRecord(item, 0), saved.SavedAt, tags, saved.Note}
+}
+
+func (r *SavedRecord) markdown() string {
+	rendered := r.ItemRecord.markdown()
+	if len(r.Tags) > 0 {
+		rendered += fmt.Sprintf("  tags: %s\n", strings.Join(r.Tags, ", "))
+	}
+	if r.Note != "" {
+		rendered += fmt.Sprintf("  note: %s\n", r.Note)
+	}
+	return rendered
+}
+
+type record interface {
+	markdown() string
+}
+
+/*
+recordWriter writes the records of a command in a structured format as they come,
+Close has to be called after the last record
+*/
+type recordWriter struct {
+	format   string
+	out      io.Writer
+	template *template.Template
+	csv      *csv.Writer
+	count    int
+}
+
+// newRecordWriter fails if the format is unknown or if the template of the template format is invalid
+func newRecordWriter(out io.Writer, format string, templateText string) (*recordWriter, error) {
+	writer := &recordWriter{format: format, out: out}
+	switch format {
+	case OUTPUT_JSON, OUTPUT_NDJSON, OUTPUT_MARKDOWN:
+	case OUTPUT_CSV:
+		writer.csv = csv.NewWriter(out)
+	case OUTPUT_TEMPLATE:
+		if templateText == "" {
+			return nil, fmt.Errorf("the template output needs a --template, e.g. '{{.Id}} {{.Title}}'")
+		}
+		parsed, err := template.New("output").Funcs(templateFuncs).Parse(templateText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		writer.template = parsed
+	default:
+		return nil, fmt.Errorf("unknown output format \"%s\", expected one of %s", format, strings.Join(OutputFormats[:], ", "))
+	}
+	return writer, nil
+}
+
+var templateFuncs = template.FuncMap{
+	// formats a unix time, e.g. {{date .Time}}
+	"date": func(unixTime any) string {
+		value := reflect.ValueOf(unixTime)
+		if !value.CanInt() {
+			return ""
+		}
+		return time.Unix(value.Int(), 0).Format("2006-01-02 15:04:05")
+	},
+	"join": strings.Join,
+}
+
+func (w *recordWriter) Write(r record) error {
+	defer func() { w.count++ }()
+	switch w.format {
+	case OUTPUT_JSON:
+		separator := ",\n  "
+		if w.count == 0 {
+			separator = "[\n  "
+		}
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w.out, "%s%s", separator, encoded)
+		return err
+	case OUTPUT_NDJSON:
+		return json.NewEncoder(w.out).Encode(r)
+	case OUTPUT_CSV:
+		header, row := csvFields(reflect.ValueOf(r).Elem())
+		if w.count == 0 {
+			if err := w.csv.Write(header); err != nil {
+				return err
+			}
+		}
+		return w.csv.Write(row)
+	case OUTPUT_MARKDOWN:
+		_, err := io.WriteString(w.out, r.markdown())
+		return err
+	default:
+		if err := w.template.Execute(w.out, r); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w.out, "\n")
+		return err
+	}
+}
+
+func (w *recordWriter) Close() error {
+	switch w.format {
+	case OUTPUT_JSON:
+		closing := "\n]\n"
+		if w.count == 0 {
+			closing = "[]\n"
+		}
+		_, err := io.WriteString(w.out, closing)
+		return err
+	case OUTPUT_CSV:
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// returns the json names and the values of the fields of the record, the embedded records are flattened
+func csvFields(value reflect.Value) ([]string, []string) {
+	header := make([]string, 0)
+	row := make([]string, 0)
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		if field.Anonymous {
+			embeddedHeader, embeddedRow := csvFields(value.Field(i))
+			header = append(header, embeddedHeader...)
+			row = append(row, embeddedRow...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		header = append(header, name)
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Slice { // the lists are separated by spaces
+			items := make([]string, fieldValue.Len())
+			for j := range items {
+				items[j] = fmt.Sprint(fieldValue.Index(j).Interface())
+			}
+			row = append(row, strings.Join(items, " "))
+			continue
+		}
+		row = append(row, fmt.Sprint(fieldValue.Interface()))
+	}
+	return header, row
+}
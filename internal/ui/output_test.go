@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"hnterminal/internal/config"
+	"hnterminal/internal/hnapi"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_Output_Json(t *testing.T) {
+	out := runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10, Output: OUTPUT_JSON})
+	var records []ItemRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatalf("Expected a JSON array, got %v:\n%s", err, out)
+	}
+	if len(records) != 2 || records[0].Id != 200 || records[1].Title != "Show HN: A terminal reader for Hacker News" {
+		t.Errorf("Expected the best stories in order, got %+v", records)
+	}
+	if records[1].HnUrl != "https://news.ycombinator.com/item?id=100" || !slices.Equal(records[1].Kids, []int{101, 102}) {
+		t.Errorf("Expected the link and the kids of the story, got %+v", records[1])
+	}
+	for _, field := range []string{`"id"`, `"by"`, `"time"`, `"score"`, `"comments"`, `"hn_url"`} {
+		if !strings.Contains(out, field) {
+			t.Errorf("Expected the field %s in the output, got:\n%s", field, out)
+		}
+	}
+
+	out = runCli(t, config.Config{Command: "search", Args: []string{"python"}, StoryCount: 10, Output: OUTPUT_JSON})
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("Expected an empty array, got:\n%s", out)
+	}
+}
+
+func Test_Output_NdjsonComments(t *testing.T) {
+	out := runCli(t, config.Config{Command: "comments", Args: []string{"100"}, Output: OUTPUT_NDJSON})
+	depths := make(map[int]int)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		var record ItemRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON object per line, got %v: %s", err, scanner.Text())
+		}
+		depths[record.Id] = record.Depth
+	}
+	if len(depths) != 5 || depths[100] != 0 || depths[101] != 1 || depths[103] != 2 {
+		t.Errorf("Expected the story and its 4 comments with their depths, got %v", depths)
+	}
+	if !strings.Contains(out, `"text":"Looks great! I'd love vim key bindings.\n\nAlso a dark theme."`) {
+		t.Errorf("Expected the text as plain text, got:\n%s", out)
+	}
+}
+
+func Test_Output_Csv(t *testing.T) {
+	out := runCli(t, config.Config{Command: "user", Args: []string{"alice"}, Output: OUTPUT_CSV})
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid csv, got %v:\n%s", err, out)
+	}
+	expected := [][]string{
+		{"id", "created", "karma", "about", "submitted", "hn_url"},
+		{"alice", "1300000000", "4321", "Building terminal tools.\n\nSay hi: alice@example.com", "103 100", "https://news.ycombinator.com/user?id=alice"},
+	}
+	if len(rows) != 2 || !slices.Equal(rows[0], expected[0]) || !slices.Equal(rows[1], expected[1]) {
+		t.Errorf("Expected %q, got %q", expected, rows)
+	}
+
+	dbPath := t.TempDir()
+	runCli(t, config.Config{Command: "save", Args: []string{"100"}, Tags: []string{"go", "tui"}, DbPath: dbPath})
+	out = runCli(t, config.Config{Command: "saved", Output: OUTPUT_CSV, DbPath: dbPath})
+	rows, _ = csv.NewReader(strings.NewReader(out)).ReadAll()
+	if len(rows) != 2 || rows[0][0] != "id" || rows[0][len(rows[0])-2] != "tags" || rows[1][len(rows[1])-2] != "go tui" {
+		t.Errorf("Expected the saved item with its tags, got %q", rows)
+	}
+}
+
+func Test_Output_MarkdownAndTemplate(t *testing.T) {
+	out := runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10, Output: OUTPUT_MARKDOWN})
+	expected := "- [Go 1.25 released](https://go.dev/blog/go1.25) - 300 points by carol, [0 comments](https://news.ycombinator.com/item?id=200)\n"
+	if !strings.HasPrefix(out, expected) {
+		t.Errorf("Expected the stories as a markdown list, got:\n%s", out)
+	}
+
+	out = runCli(t, config.Config{Command: "top", Feed: "best", StoryCount: 10, Template: "{{.Id}} {{.By}} {{date .Time | printf \"%.4s\"}}"})
+	if out != "200 carol 2023\n100 alice 2023\n" {
+		t.Errorf("Expected a line per story, got:\n%s", out)
+	}
+	if _, err := newRecordWriter(io.Discard, "yaml", ""); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+	if _, err := newRecordWriter(io.Discard, OUTPUT_TEMPLATE, "{{.Id"); err == nil {
+		t.Errorf("Expected an error for an invalid template")
+	}
+}
+
+func Test_Cli_Item(t *testing.T) {
+	out := runCli(t, config.Config{Command: "item", Args: []string{"300"}})
+	for _, expected := range []string{"Ask HN: How do you read Hacker News?", "id: 300 | type: story", "I'm curious about your workflows."} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the output to contain \"%s\", got:\n%s", expected, out)
+		}
+	}
+	out = runCli(t, config.Config{Command: "item", Args: []string{"103"}, Output: OUTPUT_NDJSON})
+	var record ItemRecord
+	if err := json.Unmarshal([]byte(out), &record); err != nil || record.Type != "comment" || record.Parent != 101 {
+		t.Errorf("Expected the comment, got %+v, %v", record, err)
+	}
+}
+
+// the fatal errors exit the process, the test runs itself in a subprocess to check the output
+func Test_Output_JsonClosedOnFatal(t *testing.T) {
+	if os.Getenv("HN_TEST_FATAL") == "1" {
+		cli := NewCli(&config.Config{Command: "top"})
+		records, err := newRecordWriter(os.Stdout, OUTPUT_JSON, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		cli.records = records
+		cli.writeRecord(NewItemRecord(&hnapi.Item{Id: 1, Type: "story", Title: "First"}, 0))
+		cli.fatal(errors.New("the next story could not be loaded\n"))
+		return
+	}
+	command := exec.Command(os.Args[0], "-test.run=^Test_Output_JsonClosedOnFatal$")
+	command.Env = append(os.Environ(), "HN_TEST_FATAL=1")
+	out, err := command.Output()
+	if exitError, ok := err.(*exec.ExitError); !ok || exitError.ExitCode() != 1 {
+		t.Fatalf("Expected the exit code 1, got %v", err)
+	}
+	var records []ItemRecord
+	if err := json.Unmarshal(out, &records); err != nil || len(records) != 1 {
+		t.Errorf("Expected the JSON array to be closed, got %v:\n%s", err, out)
+	}
+}
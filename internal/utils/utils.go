@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"container/list"
 	"fmt"
+	"html"
 	"log"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ErrorSeverity int
@@ -14,14 +20,15 @@ const (
 	ErrorSeverityFatal
 )
 
+// HandleError prints the error to stderr so it does not mix with the output, the fatal errors exit
 func HandleError(err error, severity ErrorSeverity) {
 	switch severity {
 	case ErrorSeverityWarn:
-		fmt.Printf("WARN: %s", err.Error())
+		fmt.Fprintf(os.Stderr, "WARN: %s", err.Error())
 	case ErrorSeverityError:
-		fmt.Printf("ERROR: %s", err.Error())
+		fmt.Fprintf(os.Stderr, "ERROR: %s", err.Error())
 	case ErrorSeverityFatal:
-		fmt.Printf("FATAL: %s", err.Error())
+		fmt.Fprintf(os.Stderr, "FATAL: %s", err.Error())
 		os.Exit(1)
 	}
 }
@@ -63,3 +70,155 @@ func InitLogFile() {
 	log.SetOutput(f)
 	log.Println("Starting TUI")
 }
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+/*
+HtmlToText converts the HTML subset used by Hacker News to plain text
+*/
+func HtmlToText(s string) string {
+	s = strings.ReplaceAll(s, "<p>", "\n\n")
+	s = htmlTagRegexp.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+/*
+HumanizeDuration returns the duration in its biggest unit, e.g. "3 days"
+*/
+func HumanizeDuration(d time.Duration) string {
+	units := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"year", time.Hour * 24 * 365},
+		{"month", time.Hour * 24 * 30},
+		{"day", time.Hour * 24},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if count := int(d / unit.duration); count > 0 {
+			if count == 1 {
+				return fmt.Sprintf("1 %s", unit.name)
+			}
+			return fmt.Sprintf("%d %ss", count, unit.name)
+		}
+	}
+	return "less than a minute"
+}
+
+// HumanizeBytes returns the size in its biggest binary unit, e.g. "1.5 MiB"
+func HumanizeBytes(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < 4 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, " KMGT"[unit])
+}
+
+// Truncate shortens the string to the given number of runes, marking the cut with "..."
+func Truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length]) + "..."
+}
+
+// RelativeTime returns how long ago the given time was, e.g. "3 hours ago"
+func RelativeTime(t time.Time) string {
+	return HumanizeDuration(time.Since(t)) + " ago"
+}
+
+/*
+WrapText breaks the text to lines not longer than width, keeping the line breaks of the text
+*/
+func WrapText(text string, width int) []string {
+	lines := make([]string, 0)
+	for paragraph := range strings.SplitSeq(text, "\n") {
+		line := ""
+		for word := range strings.FieldsSeq(paragraph) {
+			if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line == "" {
+				line = word
+			} else {
+				line += " " + word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+/*
+LRU is a fixed size, concurrency safe cache evicting the least recently used entries
+*/
+type LRU[K comparable, V any] struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[K]*list.Element
+	order    *list.List // the most recently used entry is at the front
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: max(capacity, 1),
+		entries:  make(map[K]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (l *LRU[K, V]) Get(key K) (V, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.entries[key]; ok {
+		l.order.MoveToFront(element)
+		return element.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (l *LRU[K, V]) Add(key K, value V) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.entries[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[K, V]{key, value})
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (l *LRU[K, V]) Remove(key K) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.entries[key]; ok {
+		l.order.Remove(element)
+		delete(l.entries, key)
+	}
+}
+
+func (l *LRU[K, V]) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.order.Len()
+}
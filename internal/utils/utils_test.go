@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func Test_LRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	lru := NewLRU[int, string](2)
+	lru.Add(1, "one")
+	lru.Add(2, "two")
+	lru.Get(1)
+	lru.Add(3, "three")
+	if _, ok := lru.Get(2); ok {
+		t.Errorf("Expected 2 to be evicted")
+	}
+	if value, ok := lru.Get(1); !ok || value != "one" {
+		t.Errorf("Expected 1 to be kept, got \"%s\"", value)
+	}
+	lru.Add(3, "THREE")
+	if value, _ := lru.Get(3); value != "THREE" || lru.Len() != 2 {
+		t.Errorf("Expected 3 to be replaced, got \"%s\" with %d entries", value, lru.Len())
+	}
+	lru.Remove(3)
+	if _, ok := lru.Get(3); ok || lru.Len() != 1 {
+		t.Errorf("Expected 3 to be removed")
+	}
+}
+
+func Test_WrapText(t *testing.T) {
+	actual := WrapText("one two three four\n\nfive", 9)
+	expected := []string{"one two", "three", "four", "", "five"}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func Test_HumanizeBytes(t *testing.T) {
+	for size, expected := range map[int64]string{512: "512 B", 1536: "1.5 KiB", 3 * 1024 * 1024: "3.0 MiB"} {
+		if humanized := HumanizeBytes(size); humanized != expected {
+			t.Errorf("Expected \"%s\", got \"%s\"", expected, humanized)
+		}
+	}
+}